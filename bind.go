@@ -0,0 +1,345 @@
+package distconf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BindingWatch is executed if registered on a Binding any time a bound variable changes
+type BindingWatch func(binding *Binding, oldValue interface{})
+
+// Binding keeps a copy of a struct bound with Bind, with every field updated to the current config value
+type Binding struct {
+	// original is the struct as it was passed to Bind
+	original reflect.Value
+	fields   []boundField
+	// hooks report values that overflow their field
+	hooks *Hooks
+
+	// Lock on watches so updates are atomic
+	mutex      sync.Mutex
+	watches    []BindingWatch
+	currentVal atomic.Value
+}
+
+// boundField is a single struct field registered with Distconf
+type boundField struct {
+	key   string
+	index []int
+	// value is the *Int, *Str, etc. registered for the field
+	value interface{}
+	// plain is true if the field holds the value itself, not the *Int, *Str, etc.
+	plain bool
+	// overflow is the last value reported to overflow the field, so it is only reported once
+	overflow interface{}
+}
+
+var errBindTarget = errors.New("bind needs a pointer to a struct")
+
+var (
+	intPtrType      = reflect.TypeOf(&Int{})
+	floatPtrType    = reflect.TypeOf(&Float{})
+	strPtrType      = reflect.TypeOf(&Str{})
+	boolPtrType     = reflect.TypeOf(&Bool{})
+	durationPtrType = reflect.TypeOf(&Duration{})
+	timeDuration    = reflect.TypeOf(time.Duration(0))
+)
+
+// Bind registers a variable for every field of the struct cfg points to that has a distconf tag, like
+//
+//	type Config struct {
+//	    Port    *distconf.Int      `distconf:"port,default=8080"`
+//	    Timeout time.Duration      `distconf:"timeout,default=1s"`
+//	    DB      struct {
+//	        Host *distconf.Str `distconf:"host,default=localhost"`
+//	    } `distconf:"db"`
+//	}
+//
+// Fields of type *Int, *Float, *Str, *Bool and *Duration are set to the registered variable.  Fields of type
+// int64 (and other ints), float64, string, bool and time.Duration are set to the current value of the variable.
+// Nested structs prefix the keys of their fields with their own key and a period, so the key of DB.Host is
+// db.host.  An empty key uses the field name.  Fields without a tag, or with the tag "-", are ignored.
+//
+// The returned Binding keeps a copy of the struct with plain value fields updated on every change.  Every field
+// that cannot be bound is reported in the returned KeyErrors.  A value that does not fit a smaller field, like 300
+// in an int8, is reported to Hooks.OnError and the field keeps its last value.
+func (c *Distconf) Bind(ctx context.Context, cfg interface{}) (*Binding, error) {
+	site := c.caller(1)
+	ptr := reflect.ValueOf(cfg)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() || ptr.Elem().Kind() != reflect.Struct {
+		return nil, errBindTarget
+	}
+	b := &Binding{hooks: &c.Hooks}
+	errs := make(KeyErrors)
+	c.bindStruct(ctx, b, ptr.Elem().Type(), nil, "", errs)
+	if len(errs) != 0 {
+		return nil, errs
+	}
+	// Info shows where Bind was called, not where bindStruct registered the key
+	for _, f := range b.fields {
+		if site.ok {
+			c.setCallSite(f.key, site)
+		}
+	}
+	b.original = reflect.New(ptr.Elem().Type()).Elem()
+	b.original.Set(ptr.Elem())
+	initial := b.build(b.original)
+	ptr.Elem().Set(reflect.ValueOf(initial))
+	b.currentVal.Store(initial)
+	for _, f := range b.fields {
+		b.watchField(f)
+	}
+	// Catch changes that happened before the watches were added
+	b.update()
+	return b, nil
+}
+
+// bindStruct registers every tagged field of t.  index is the path to t from the bound struct.
+func (c *Distconf) bindStruct(ctx context.Context, b *Binding, t reflect.Type, index []int, prefix string, errs KeyErrors) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, exists := field.Tag.Lookup("distconf")
+		if !exists || tag == "-" {
+			continue
+		}
+		key, defaultVal, err := parseBindTag(tag)
+		fieldIndex := append(index[:len(index):len(index)], i)
+		if key == "" {
+			key = field.Name
+		}
+		key = prefix + key
+		if err != nil {
+			errs[key] = err
+			continue
+		}
+		if field.PkgPath != "" {
+			errs[key] = fmt.Errorf("field %s is not exported", field.Name)
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct {
+			c.bindStruct(ctx, b, field.Type, fieldIndex, key+".", errs)
+			continue
+		}
+		value, plain, err := c.bindField(ctx, key, field.Type, defaultVal)
+		if err != nil {
+			errs[key] = err
+			continue
+		}
+		b.fields = append(b.fields, boundField{
+			key:   key,
+			index: fieldIndex,
+			value: value,
+			plain: plain,
+		})
+	}
+}
+
+// parseBindTag splits a tag like "key,default=value".  Everything after default= is the default, even commas.
+func parseBindTag(tag string) (string, string, error) {
+	parts := strings.SplitN(tag, ",", 2)
+	if len(parts) == 1 {
+		return parts[0], "", nil
+	}
+	if !strings.HasPrefix(parts[1], "default=") {
+		return parts[0], "", fmt.Errorf("unknown tag option %s", parts[1])
+	}
+	return parts[0], strings.TrimPrefix(parts[1], "default="), nil
+}
+
+// bindField registers key as the variable type that fits t, and returns the *Int, *Str, etc.  plain is true if t
+// holds a value instead of the variable.
+func (c *Distconf) bindField(ctx context.Context, key string, t reflect.Type, defaultVal string) (interface{}, bool, error) {
+	switch {
+	case t == intPtrType:
+		return c.bindInt(ctx, key, defaultVal, false)
+	case t == floatPtrType:
+		return c.bindFloat(ctx, key, defaultVal, false)
+	case t == strPtrType:
+		return c.bindStr(ctx, key, defaultVal, false)
+	case t == boolPtrType:
+		return c.bindBool(ctx, key, defaultVal, false)
+	case t == durationPtrType:
+		return c.bindDuration(ctx, key, defaultVal, false)
+	case t == timeDuration:
+		return c.bindDuration(ctx, key, defaultVal, true)
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return c.bindInt(ctx, key, defaultVal, true)
+	case reflect.Float32, reflect.Float64:
+		return c.bindFloat(ctx, key, defaultVal, true)
+	case reflect.String:
+		return c.bindStr(ctx, key, defaultVal, true)
+	case reflect.Bool:
+		return c.bindBool(ctx, key, defaultVal, true)
+	}
+	return nil, false, fmt.Errorf("unable to bind type %s", t)
+}
+
+var errBindTypeConflict = errors.New("key is already registered with another type")
+
+func (c *Distconf) bindInt(ctx context.Context, key string, defaultVal string, plain bool) (interface{}, bool, error) {
+	var def int64
+	if defaultVal != "" {
+		var err error
+		if def, err = strconv.ParseInt(defaultVal, 10, 64); err != nil {
+			return nil, false, fmt.Errorf("invalid default: %v", err)
+		}
+	}
+	v := c.Int(ctx, key, def)
+	if v == nil {
+		return nil, false, errBindTypeConflict
+	}
+	return v, plain, nil
+}
+
+func (c *Distconf) bindFloat(ctx context.Context, key string, defaultVal string, plain bool) (interface{}, bool, error) {
+	var def float64
+	if defaultVal != "" {
+		var err error
+		if def, err = strconv.ParseFloat(defaultVal, 64); err != nil {
+			return nil, false, fmt.Errorf("invalid default: %v", err)
+		}
+	}
+	v := c.Float(ctx, key, def)
+	if v == nil {
+		return nil, false, errBindTypeConflict
+	}
+	return v, plain, nil
+}
+
+func (c *Distconf) bindStr(ctx context.Context, key string, defaultVal string, plain bool) (interface{}, bool, error) {
+	v := c.Str(ctx, key, defaultVal)
+	if v == nil {
+		return nil, false, errBindTypeConflict
+	}
+	return v, plain, nil
+}
+
+func (c *Distconf) bindBool(ctx context.Context, key string, defaultVal string, plain bool) (interface{}, bool, error) {
+	var def bool
+	if defaultVal != "" {
+		var err error
+		if def, err = strconv.ParseBool(defaultVal); err != nil {
+			return nil, false, fmt.Errorf("invalid default: %v", err)
+		}
+	}
+	v := c.Bool(ctx, key, def)
+	if v == nil {
+		return nil, false, errBindTypeConflict
+	}
+	return v, plain, nil
+}
+
+func (c *Distconf) bindDuration(ctx context.Context, key string, defaultVal string, plain bool) (interface{}, bool, error) {
+	var def time.Duration
+	if defaultVal != "" {
+		var err error
+		if def, err = time.ParseDuration(defaultVal); err != nil {
+			return nil, false, fmt.Errorf("invalid default: %v", err)
+		}
+	}
+	v := c.Duration(ctx, key, def)
+	if v == nil {
+		return nil, false, errBindTypeConflict
+	}
+	return v, plain, nil
+}
+
+// watchField updates b every time the variable of f changes
+func (b *Binding) watchField(f boundField) {
+	switch v := f.value.(type) {
+	case *Int:
+		v.Watch(func(*Int, int64) { b.update() })
+	case *Float:
+		v.Watch(func(*Float, float64) { b.update() })
+	case *Str:
+		v.Watch(func(*Str, string) { b.update() })
+	case *Bool:
+		v.Watch(func(*Bool, bool) { b.update() })
+	case *Duration:
+		v.Watch(func(*Duration, time.Duration) { b.update() })
+	}
+}
+
+// build a copy of previous with the current value of every field.  Fields keep their value in previous if the
+// current value overflows them.  Must hold b.mutex once the Binding is watching its fields.
+func (b *Binding) build(previous reflect.Value) interface{} {
+	ret := reflect.New(b.original.Type()).Elem()
+	ret.Set(previous)
+	for i := range b.fields {
+		f := &b.fields[i]
+		field := ret.FieldByIndex(f.index)
+		if !f.plain {
+			field.Set(reflect.ValueOf(f.value))
+			continue
+		}
+		switch v := f.value.(type) {
+		case *Int:
+			if val := v.Get(); field.OverflowInt(val) {
+				b.onOverflow(f, val, field.Type())
+			} else {
+				field.SetInt(val)
+				f.overflow = nil
+			}
+		case *Float:
+			if val := v.Get(); field.OverflowFloat(val) {
+				b.onOverflow(f, val, field.Type())
+			} else {
+				field.SetFloat(val)
+				f.overflow = nil
+			}
+		case *Str:
+			field.SetString(v.Get())
+		case *Bool:
+			field.SetBool(v.Get())
+		case *Duration:
+			field.SetInt(int64(v.Get()))
+		}
+	}
+	return ret.Interface()
+}
+
+// onOverflow reports that val does not fit the field of f, unless it was already reported
+func (b *Binding) onOverflow(f *boundField, val interface{}, t reflect.Type) {
+	if f.overflow == val {
+		return
+	}
+	f.overflow = val
+	b.hooks.onError("unable to bind value", f.key, fmt.Errorf("%v overflows %s", val, t))
+}
+
+// update stores a new copy and executes watches if any field changed
+func (b *Binding) update() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	oldValue := b.Get()
+	newValue := b.build(reflect.ValueOf(oldValue))
+	if reflect.DeepEqual(oldValue, newValue) {
+		return
+	}
+	b.currentVal.Store(newValue)
+	for _, w := range b.watches {
+		w(b, oldValue)
+	}
+}
+
+// Get a copy of the bound struct, with every field set to its current value.  The returned value is the struct
+// itself, not a pointer to it.
+func (b *Binding) Get() interface{} {
+	return b.currentVal.Load()
+}
+
+// Watch adds a watch for changes to any bound field
+func (b *Binding) Watch(watch BindingWatch) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.watches = append(b.watches, watch)
+}
@@ -0,0 +1,151 @@
+package distconf
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bindDB struct {
+	Host    *Str  `distconf:"host,default=localhost"`
+	Port    int32 `distconf:"port,default=5432"`
+	Options struct {
+		TLS bool `distconf:"tls"`
+	} `distconf:"options"`
+}
+
+type bindConfig struct {
+	Port      *Int          `distconf:"port,default=8080"`
+	Ratio     *Float        `distconf:"ratio,default=0.5"`
+	Enabled   *Bool         `distconf:"enabled,default=true"`
+	Timeout   *Duration     `distconf:"timeout,default=1s"`
+	Name      string        `distconf:"name,default=a,b"`
+	Interval  time.Duration `distconf:"interval,default=1m"`
+	Weight    float64       `distconf:",default=2"`
+	DB        bindDB        `distconf:"db"`
+	Untouched string
+	Skipped   *Int `distconf:"-"`
+}
+
+func TestDistconf_Bind(t *testing.T) {
+	ctx := context.Background()
+	m := &Mem{}
+	require.NoError(t, m.Write(ctx, "db.port", []byte("6543")))
+	require.NoError(t, m.Write(ctx, "db.options.tls", []byte("true")))
+	conf := &Distconf{Readers: []Reader{m}}
+	defer mustShutdown(t, conf)
+
+	cfg := bindConfig{Untouched: "original"}
+	b, err := conf.Bind(ctx, &cfg)
+	require.NoError(t, err)
+	assert.Equal(t, int64(8080), cfg.Port.Get())
+	assert.Equal(t, 0.5, cfg.Ratio.Get())
+	assert.True(t, cfg.Enabled.Get())
+	assert.Equal(t, time.Second, cfg.Timeout.Get())
+	assert.Equal(t, "a,b", cfg.Name)
+	assert.Equal(t, time.Minute, cfg.Interval)
+	assert.Equal(t, 2.0, cfg.Weight)
+	assert.Equal(t, "localhost", cfg.DB.Host.Get())
+	assert.Equal(t, int32(6543), cfg.DB.Port)
+	assert.True(t, cfg.DB.Options.TLS)
+	assert.Equal(t, "original", cfg.Untouched)
+	assert.Nil(t, cfg.Skipped)
+	assert.Equal(t, cfg, b.Get().(bindConfig))
+
+	// Info shows the call of Bind
+	var info map[string]distInfo
+	require.NoError(t, json.Unmarshal([]byte(conf.Info().String()), &info))
+	for _, key := range []string{"port", "Weight", "db.options.tls"} {
+		assert.Equal(t, "bind_test.go", filepath.Base(info[key].File), key)
+		assert.Equal(t, info["port"].Line, info[key].Line, key)
+	}
+
+	var changes int
+	b.Watch(func(binding *Binding, oldValue interface{}) {
+		changes++
+		assert.Equal(t, "a,b", oldValue.(bindConfig).Name)
+	})
+	require.NoError(t, m.Write(ctx, "name", []byte("c")))
+	require.NoError(t, m.Write(ctx, "port", []byte("9090")))
+	current := b.Get().(bindConfig)
+	assert.Equal(t, "c", current.Name)
+	assert.Equal(t, int64(9090), current.Port.Get())
+	assert.Equal(t, 1, changes)
+	// The original struct is a copy that never changes
+	assert.Equal(t, "a,b", cfg.Name)
+}
+
+func TestDistconf_Bind_errors(t *testing.T) {
+	ctx := context.Background()
+	conf := &Distconf{}
+	defer mustShutdown(t, conf)
+	conf.Str(ctx, "conflict", "")
+
+	_, err := conf.Bind(ctx, bindConfig{})
+	assert.Equal(t, errBindTarget, err)
+	var nilPtr *bindConfig
+	_, err = conf.Bind(ctx, nilPtr)
+	assert.Equal(t, errBindTarget, err)
+
+	var bad struct {
+		Int      int64     `distconf:"int,default=abc"`
+		Float    float64   `distconf:"float,default=abc"`
+		Bool     bool      `distconf:"bool,default=abc"`
+		Duration *Duration `distconf:"duration,default=abc"`
+		Option   string    `distconf:"option,required"`
+		Type     []string  `distconf:"type"`
+		Conflict *Int      `distconf:"conflict"`
+		Good     *Int      `distconf:"good"`
+		private  string    `distconf:"private"`
+	}
+	_, err = conf.Bind(ctx, &bad)
+	require.Error(t, err)
+	errs := err.(KeyErrors)
+	assert.Len(t, errs, 8)
+	assert.Equal(t, errBindTypeConflict, errs["conflict"])
+	assert.NotContains(t, errs, "good")
+	assert.Empty(t, bad.private)
+}
+
+func TestDistconf_Bind_overflow(t *testing.T) {
+	ctx := context.Background()
+	m := &Mem{}
+	require.NoError(t, m.Write(ctx, "small", []byte("300")))
+	require.NoError(t, m.Write(ctx, "ratio", []byte("1e300")))
+	var errs []string
+	conf := &Distconf{Readers: []Reader{m}}
+	conf.Hooks.OnError = func(msg string, distconfKey string, err error) {
+		errs = append(errs, distconfKey)
+	}
+	defer mustShutdown(t, conf)
+
+	type smallConfig struct {
+		Small int8    `distconf:"small,default=1"`
+		Ratio float32 `distconf:"ratio,default=0.5"`
+	}
+	cfg := smallConfig{Small: 2, Ratio: 0.25}
+	b, err := conf.Bind(ctx, &cfg)
+	require.NoError(t, err)
+	// Values that overflow keep the field as it was
+	assert.Equal(t, int8(2), cfg.Small)
+	assert.Equal(t, float32(0.25), cfg.Ratio)
+	assert.Equal(t, []string{"small", "ratio"}, errs)
+
+	require.NoError(t, m.Write(ctx, "small", []byte("-5")))
+	require.NoError(t, m.Write(ctx, "ratio", []byte("1.5")))
+	current := b.Get().(smallConfig)
+	assert.Equal(t, int8(-5), current.Small)
+	assert.Equal(t, float32(1.5), current.Ratio)
+
+	// The last value that fit is kept, and the overflow is only reported once
+	errs = nil
+	require.NoError(t, m.Write(ctx, "small", []byte("-129")))
+	require.NoError(t, m.Write(ctx, "ratio", []byte("2")))
+	assert.Equal(t, int8(-5), b.Get().(smallConfig).Small)
+	assert.Equal(t, []string{"small"}, errs)
+}
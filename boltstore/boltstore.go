@@ -0,0 +1,163 @@
+// Package boltstore persists distconf keys inside a local bbolt file, for single node tools that want durable
+// config without running a server.
+package boltstore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cep21/distconf"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Store reads and writes keys inside a bbolt bucket.  Like distconf.Mem, writes notify watchers in process, so it
+// can replace Mem anywhere persistence is needed.  All public functions are thread safe.
+type Store struct {
+	// DB holds the keys
+	DB *bolt.DB
+	// Bucket keys are stored in.  Defaults to "distconf"
+	Bucket string
+
+	// ownsDB is true when Open created DB, so Shutdown should close it
+	ownsDB      bool
+	mu          sync.Mutex
+	watches     map[string][]storeWatch
+	nextWatchID uint64
+}
+
+type storeWatch struct {
+	id       uint64
+	callback func()
+}
+
+var _ distconf.Reader = &Store{}
+var _ distconf.Watcher = &Store{}
+var _ distconf.Subscriber = &Store{}
+var _ distconf.Shutdownable = &Store{}
+
+// Open creates a Store backed by the bbolt file at path, creating it if needed.  The Store closes the file on
+// Shutdown.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &Store{
+		DB:     db,
+		ownsDB: true,
+	}, nil
+}
+
+func (s *Store) bucket() []byte {
+	if s.Bucket == "" {
+		return []byte("distconf")
+	}
+	return []byte(s.Bucket)
+}
+
+// Read returns the stored value of key
+func (s *Store) Read(_ context.Context, key string) ([]byte, error) {
+	var ret []byte
+	err := s.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(s.bucket())
+		if b == nil {
+			return nil
+		}
+		if v := b.Get([]byte(key)); v != nil {
+			// Values are only valid inside the transaction
+			ret = append(make([]byte, 0, len(v)), v...)
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// Write persists value for key, then executes the watches of key.  A nil value deletes the key.
+func (s *Store) Write(ctx context.Context, key string, value []byte) error {
+	return s.WriteMany(ctx, map[string][]byte{key: value})
+}
+
+// WriteMany persists every key in a single transaction, deleting keys with a nil value.  Watches are executed only
+// after the transaction commits, so they never see a partial update.
+func (s *Store) WriteMany(_ context.Context, values map[string][]byte) error {
+	err := s.DB.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(s.bucket())
+		if err != nil {
+			return err
+		}
+		for key, value := range values {
+			if value == nil {
+				err = b.Delete([]byte(key))
+			} else {
+				err = b.Put([]byte(key), value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	var toExec []func()
+	s.mu.Lock()
+	for key := range values {
+		for _, w := range s.watches[key] {
+			toExec = append(toExec, w.callback)
+		}
+	}
+	s.mu.Unlock()
+	for _, callback := range toExec {
+		callback()
+	}
+	return nil
+}
+
+// Watch adds callback to the callbacks of key.  A nil callback removes every callback of key.  Use Subscribe to
+// remove a single callback.
+func (s *Store) Watch(_ context.Context, key string, callback func()) error {
+	if callback == nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.watches, key)
+		return nil
+	}
+	s.Subscribe(key, callback)
+	return nil
+}
+
+// Subscribe adds callback to the callbacks of key, and returns a function that removes it
+func (s *Store) Subscribe(key string, callback func()) (unsubscribe func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.watches == nil {
+		s.watches = make(map[string][]storeWatch)
+	}
+	s.nextWatchID++
+	id := s.nextWatchID
+	s.watches[key] = append(s.watches[key], storeWatch{id: id, callback: callback})
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		watches := s.watches[key]
+		for i, w := range watches {
+			if w.id == id {
+				s.watches[key] = append(watches[:i:i], watches[i+1:]...)
+				break
+			}
+		}
+		if len(s.watches[key]) == 0 {
+			delete(s.watches, key)
+		}
+	}
+}
+
+// Shutdown closes DB if it was created by Open
+func (s *Store) Shutdown(_ context.Context) error {
+	if !s.ownsDB {
+		return nil
+	}
+	return s.DB.Close()
+}
@@ -0,0 +1,123 @@
+package boltstore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/cep21/distconf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func mustShutdown(t *testing.T, s distconf.Shutdownable) {
+	require.NoError(t, s.Shutdown(context.Background()))
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "config.db")
+	s, err := Open(path)
+	require.NoError(t, err)
+	conf := &distconf.Distconf{
+		Readers: []distconf.Reader{s},
+	}
+
+	b, err := s.Read(ctx, "port")
+	require.NoError(t, err)
+	assert.Nil(t, b)
+
+	port := conf.Int(ctx, "port", 1)
+	assert.Equal(t, int64(1), port.Get())
+	require.NoError(t, s.Write(ctx, "port", []byte("8080")))
+	assert.Equal(t, int64(8080), port.Get())
+	require.NoError(t, s.Write(ctx, "host", []byte("example.com")))
+	require.NoError(t, s.Write(ctx, "host", nil))
+	mustShutdown(t, conf)
+	mustShutdown(t, s)
+
+	// Values survive reopening the file
+	s, err = Open(path)
+	require.NoError(t, err)
+	defer mustShutdown(t, s)
+	conf = &distconf.Distconf{
+		Readers: []distconf.Reader{s},
+	}
+	defer mustShutdown(t, conf)
+	assert.Equal(t, int64(8080), conf.Int(ctx, "port", 1).Get())
+	assert.Equal(t, "default", conf.Str(ctx, "host", "default").Get())
+
+	require.NoError(t, s.Watch(ctx, "port", nil))
+	require.NoError(t, s.Write(ctx, "port", []byte("9090")))
+	assert.Equal(t, int64(8080), conf.Int(ctx, "port", 1).Get())
+}
+
+func TestStore_sharedDB(t *testing.T) {
+	ctx := context.Background()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "config.db"), 0600, nil)
+	require.NoError(t, err)
+	s := &Store{DB: db, Bucket: "app"}
+	require.NoError(t, s.Write(ctx, "a", []byte("1")))
+	// Shutdown does not close a DB it did not open
+	mustShutdown(t, s)
+	b, err := s.Read(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(b))
+
+	require.NoError(t, db.Close())
+	_, err = s.Read(ctx, "a")
+	assert.Error(t, err)
+	assert.Error(t, s.Write(ctx, "a", []byte("2")))
+
+	_, err = Open(filepath.Join(t.TempDir(), "missing", "config.db"))
+	assert.Error(t, err)
+}
+
+func TestStore_sharedByDistconfs(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(filepath.Join(t.TempDir(), "config.db"))
+	require.NoError(t, err)
+	defer mustShutdown(t, s)
+	first := &distconf.Distconf{Readers: []distconf.Reader{s}}
+	second := &distconf.Distconf{Readers: []distconf.Reader{s}}
+	defer mustShutdown(t, second)
+	firstPort := first.Int(ctx, "port", 0)
+	secondPort := second.Int(ctx, "port", 0)
+
+	// Both watchers of port see the write
+	require.NoError(t, s.Write(ctx, "port", []byte("8080")))
+	assert.Equal(t, int64(8080), firstPort.Get())
+	assert.Equal(t, int64(8080), secondPort.Get())
+
+	// Shutting down one Distconf leaves the watch of the other
+	mustShutdown(t, first)
+	require.NoError(t, s.Write(ctx, "port", []byte("9090")))
+	assert.Equal(t, int64(9090), secondPort.Get())
+	s.mu.Lock()
+	assert.Len(t, s.watches["port"], 1)
+	s.mu.Unlock()
+}
+
+func TestStore_WriteMany(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(filepath.Join(t.TempDir(), "config.db"))
+	require.NoError(t, err)
+	defer mustShutdown(t, s)
+	require.NoError(t, s.Write(ctx, "b", []byte("old")))
+	var seen []string
+	unsubscribe := s.Subscribe("a", func() {
+		b, err := s.Read(ctx, "b")
+		require.NoError(t, err)
+		seen = append(seen, string(b))
+	})
+	require.NoError(t, s.WriteMany(ctx, map[string][]byte{"a": []byte("1"), "b": []byte("new")}))
+	assert.Equal(t, []string{"new"}, seen)
+
+	unsubscribe()
+	require.NoError(t, s.WriteMany(ctx, map[string][]byte{"a": nil, "b": nil}))
+	assert.Equal(t, []string{"new"}, seen)
+	b, err := s.Read(ctx, "a")
+	require.NoError(t, err)
+	assert.Nil(t, b)
+}
@@ -0,0 +1,252 @@
+package distconf
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// CachingReader wraps a Reader and caches what it reads, including keys that are absent, so repeated reads and
+// refreshes don't all go to a remote backend.  Cached keys are invalidated by the wrapped Reader's Watch callbacks
+// and expire after a TTL.  Errors are never cached.  Versions of a VersionedReader are cached with their value, and
+// ReadMany of a BatchReader only reads the keys that are not cached.  Watcher, Subscriber and Shutdownable are
+// forwarded to the wrapped Reader.  All public functions are thread safe.
+type CachingReader struct {
+	// Reader is the wrapped backend
+	Reader Reader
+	// TTL is how long a present key is cached.  Defaults to 1 minute
+	TTL time.Duration
+	// NegativeTTL is how long an absent key is cached.  Defaults to TTL.  A negative NegativeTTL disables caching
+	// absent keys
+	NegativeTTL time.Duration
+	// MaxSize is the most keys cached at once.  The least recently used key is evicted when it is exceeded.
+	// Zero means no limit
+	MaxSize int
+	// Now defaults to time.Now
+	Now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     list.List
+	// epoch changes on every invalidation, so a Read racing with one does not cache a stale value
+	epoch uint64
+	stats CacheStats
+}
+
+// CacheStats are counters of a CachingReader
+type CacheStats struct {
+	// Hits are reads served from the cache
+	Hits int64
+	// Misses are reads that went to the wrapped Reader
+	Misses int64
+	// Evictions are keys removed to stay under MaxSize
+	Evictions int64
+	// Size is how many keys are currently cached
+	Size int
+}
+
+type cacheEntry struct {
+	key       string
+	value     []byte
+	version   int64
+	expiresAt time.Time
+}
+
+var _ Reader = &CachingReader{}
+var _ VersionedReader = &CachingReader{}
+var _ BatchReader = &CachingReader{}
+var _ Watcher = &CachingReader{}
+var _ Subscriber = &CachingReader{}
+var _ Shutdownable = &CachingReader{}
+
+func (c *CachingReader) now() time.Time {
+	if c.Now == nil {
+		return time.Now()
+	}
+	return c.Now()
+}
+
+func (c *CachingReader) ttl() time.Duration {
+	if c.TTL == 0 {
+		return time.Minute
+	}
+	return c.TTL
+}
+
+func (c *CachingReader) negativeTTL() time.Duration {
+	if c.NegativeTTL == 0 {
+		return c.ttl()
+	}
+	return c.NegativeTTL
+}
+
+func (c *CachingReader) wrapped() Reader {
+	return c.Reader
+}
+
+// Read key from the cache, or from the wrapped Reader if it is not cached or has expired
+func (c *CachingReader) Read(ctx context.Context, key string) ([]byte, error) {
+	value, _, err := c.ReadVersioned(ctx, key)
+	return value, err
+}
+
+// ReadVersioned reads key like Read, with the version of the wrapped Reader if it is a VersionedReader
+func (c *CachingReader) ReadVersioned(ctx context.Context, key string) ([]byte, int64, error) {
+	if entry, hit := c.lookup(key); hit {
+		return entry.value, entry.version, nil
+	}
+	c.mu.Lock()
+	epoch := c.epoch
+	c.mu.Unlock()
+	b, version, err := readVersioned(ctx, c.Reader, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	c.store(epoch, key, b, version)
+	return b, version, nil
+}
+
+// ReadMany reads the keys that are not cached with a single ReadMany of the wrapped Reader, or one key at a time
+// if it is not a BatchReader.  What it reads is not cached if the wrapped Reader is a VersionedReader.
+func (c *CachingReader) ReadMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	ret := make(map[string][]byte, len(keys))
+	var missing []string
+	for _, key := range keys {
+		entry, hit := c.lookup(key)
+		if !hit {
+			missing = append(missing, key)
+			continue
+		}
+		if entry.value != nil {
+			ret[key] = entry.value
+		}
+	}
+	if len(missing) == 0 {
+		return ret, nil
+	}
+	c.mu.Lock()
+	epoch := c.epoch
+	c.mu.Unlock()
+	values, err := readMany(ctx, c.Reader, missing)
+	if err != nil {
+		return nil, err
+	}
+	// ReadMany has no versions, so caching its values would hide the versions of a VersionedReader from Read
+	versioned := isVersioned(c.Reader)
+	for _, key := range missing {
+		if !versioned {
+			c.store(epoch, key, values[key], 0)
+		}
+		if values[key] != nil {
+			ret[key] = values[key]
+		}
+	}
+	return ret, nil
+}
+
+// lookup returns the cached entry of key, counting a hit or a miss
+func (c *CachingReader) lookup(key string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, exists := c.entries[key]; exists {
+		entry := elem.Value.(*cacheEntry)
+		if c.now().Before(entry.expiresAt) {
+			c.lru.MoveToFront(elem)
+			c.stats.Hits++
+			return *entry, true
+		}
+		c.remove(elem)
+	}
+	c.stats.Misses++
+	return cacheEntry{}, false
+}
+
+// store caches b for key, unless the cache was invalidated since epoch
+func (c *CachingReader) store(epoch uint64, key string, b []byte, version int64) {
+	ttl := c.ttl()
+	if b == nil {
+		ttl = c.negativeTTL()
+	}
+	if ttl < 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if epoch != c.epoch {
+		return
+	}
+	if elem, exists := c.entries[key]; exists {
+		c.remove(elem)
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{
+		key:       key,
+		value:     b,
+		version:   version,
+		expiresAt: c.now().Add(ttl),
+	})
+	for c.MaxSize > 0 && c.lru.Len() > c.MaxSize {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+// remove elem from the cache.  Must hold c.mu.
+func (c *CachingReader) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).key)
+}
+
+// Invalidate removes key from the cache, so the next Read goes to the wrapped Reader
+func (c *CachingReader) Invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epoch++
+	if elem, exists := c.entries[key]; exists {
+		c.remove(elem)
+	}
+}
+
+// Stats returns the current counters of the cache
+func (c *CachingReader) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Size = c.lru.Len()
+	return stats
+}
+
+// Watch forwards to the wrapped Reader if it is a Watcher.  key is invalidated before callback is called.  A nil
+// callback is forwarded as is, so the wrapped Reader removes its callbacks.
+func (c *CachingReader) Watch(ctx context.Context, key string, callback func()) error {
+	w, ok := c.Reader.(Watcher)
+	if !ok {
+		return nil
+	}
+	if callback == nil {
+		return w.Watch(ctx, key, nil)
+	}
+	return w.Watch(ctx, key, func() {
+		c.Invalidate(key)
+		callback()
+	})
+}
+
+// Subscribe forwards to the wrapped Reader if it is a Subscriber.  key is invalidated before callback is called.
+func (c *CachingReader) Subscribe(key string, callback func()) func() {
+	return subscribe(c.Reader, key, func() {
+		c.Invalidate(key)
+		callback()
+	})
+}
+
+// Shutdown forwards to the wrapped Reader if it is Shutdownable
+func (c *CachingReader) Shutdown(ctx context.Context) error {
+	if s, ok := c.Reader.(Shutdownable); ok {
+		return s.Shutdown(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package distconf
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachingReader(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+	backing := &countingBacking{}
+	require.NoError(t, backing.Write(ctx, "port", []byte("8080")))
+	c := &CachingReader{
+		Reader:      backing,
+		TTL:         time.Minute,
+		NegativeTTL: time.Second,
+		Now: func() time.Time {
+			return now
+		},
+	}
+	read := func(key string) string {
+		b, err := c.Read(ctx, key)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	assert.Equal(t, "8080", read("port"))
+	assert.Equal(t, "8080", read("port"))
+	assert.Equal(t, "", read("host"))
+	assert.Equal(t, "", read("host"))
+	assert.Equal(t, int64(2), atomic.LoadInt64(&backing.reads))
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 2, Size: 2}, c.Stats())
+
+	// Absent keys expire first
+	require.NoError(t, backing.Mem.Write(ctx, "host", []byte("a.com")))
+	now = now.Add(time.Second)
+	assert.Equal(t, "a.com", read("host"))
+	assert.Equal(t, "8080", read("port"))
+	assert.Equal(t, int64(3), atomic.LoadInt64(&backing.reads))
+	now = now.Add(time.Minute)
+	assert.Equal(t, "8080", read("port"))
+	assert.Equal(t, int64(4), atomic.LoadInt64(&backing.reads))
+
+	// Errors are not cached
+	atomic.StoreInt64(&backing.failures, 5)
+	_, err := c.Read(ctx, "missing")
+	assert.Equal(t, errNope, err)
+	assert.Equal(t, 2, c.Stats().Size)
+}
+
+func TestCachingReader_watch(t *testing.T) {
+	ctx := context.Background()
+	m := &Mem{}
+	require.NoError(t, m.Write(ctx, "port", []byte("8080")))
+	c := &CachingReader{Reader: m}
+	conf := &Distconf{Readers: []Reader{c}}
+
+	port := conf.Int(ctx, "port", 0)
+	assert.Equal(t, int64(8080), port.Get())
+	require.NoError(t, m.Write(ctx, "port", []byte("9090")))
+	assert.Equal(t, int64(9090), port.Get())
+	require.NoError(t, m.Write(ctx, "port", nil))
+	assert.Equal(t, int64(0), port.Get())
+	assert.Equal(t, int64(0), c.Stats().Hits)
+
+	// Shutdown removes the callbacks from the wrapped Reader
+	mustShutdown(t, conf)
+	assert.Empty(t, m.watches)
+	require.NoError(t, m.Write(ctx, "port", []byte("1")))
+	assert.Equal(t, errNope, (&CachingReader{Reader: &allErrorBacking{}}).Watch(ctx, "port", func() {}))
+}
+
+func TestCachingReader_maxSize(t *testing.T) {
+	ctx := context.Background()
+	m := &Mem{}
+	c := &CachingReader{Reader: m, MaxSize: 2, NegativeTTL: -1}
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, m.Write(ctx, key, []byte(key)))
+	}
+	_, err := c.Read(ctx, "missing")
+	require.NoError(t, err)
+	assert.Equal(t, 0, c.Stats().Size)
+
+	for _, key := range []string{"a", "b", "a", "c"} {
+		_, err := c.Read(ctx, key)
+		require.NoError(t, err)
+	}
+	// b was the least recently used
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 4, Evictions: 1, Size: 2}, c.Stats())
+	_, err = c.Read(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), c.Stats().Hits)
+	c.Invalidate("a")
+	assert.Equal(t, 1, c.Stats().Size)
+}
+
+func TestCachingReader_ReadMany(t *testing.T) {
+	ctx := context.Background()
+	m := &Mem{}
+	require.NoError(t, m.Write(ctx, "port", []byte("8080")))
+	c := &CachingReader{Reader: m}
+	values, err := c.ReadMany(ctx, []string{"port", "host"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"port": []byte("8080")}, values)
+	_, err = c.Read(ctx, "port")
+	require.NoError(t, err)
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 2, Size: 2}, c.Stats())
+
+	// Values read without their version are not cached for a VersionedReader
+	backing := &versionedBacking{}
+	backing.set("8080", 3)
+	c = &CachingReader{Reader: backing}
+	values, err = c.ReadMany(ctx, []string{"port"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"port": []byte("8080")}, values)
+	b, version, err := c.ReadVersioned(ctx, "port")
+	require.NoError(t, err)
+	assert.Equal(t, "8080", string(b))
+	assert.Equal(t, int64(3), version)
+	assert.Equal(t, CacheStats{Misses: 2, Size: 1}, c.Stats())
+}
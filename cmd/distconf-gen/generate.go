@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// view is what the templates render
+type view struct {
+	Package    string
+	Type       string
+	ImportPath string
+	Keys       []keyView
+	// NeedsTime is true if the code uses the time package
+	NeedsTime bool
+	// TestNeedsTime is true if the test uses the time package
+	TestNeedsTime bool
+	HasChecks     bool
+}
+
+type keyView struct {
+	keySchema
+	DistconfType   string
+	DefaultLiteral string
+	Checks         []checkView
+}
+
+// checkView is a single validator rendered as Go
+type checkView struct {
+	// Failed is a Go expression on v that is true if the value is invalid
+	Failed string
+	// Message is a quoted Go string the value is appended to
+	Message string
+}
+
+func newView(s *schema, importPath string) *view {
+	v := &view{
+		Package:    s.Package,
+		Type:       s.Type,
+		ImportPath: importPath,
+	}
+	for _, k := range s.Keys {
+		kv := keyView{
+			keySchema:      k,
+			DistconfType:   distconfTypes[k.Type],
+			DefaultLiteral: literal(k.Type, k.Default),
+		}
+		v.TestNeedsTime = v.TestNeedsTime || strings.Contains(kv.DefaultLiteral, "time.")
+		v.NeedsTime = v.NeedsTime || v.TestNeedsTime
+		for _, val := range k.validators {
+			c := check(k, val)
+			v.NeedsTime = v.NeedsTime || strings.Contains(c.Failed, "time.")
+			kv.Checks = append(kv.Checks, c)
+		}
+		v.HasChecks = v.HasChecks || len(kv.Checks) > 0
+		v.Keys = append(v.Keys, kv)
+	}
+	return v
+}
+
+// literal returns value of keyType as a Go expression.  An empty value is the zero value.
+func literal(keyType string, value string) string {
+	switch keyType {
+	case "int":
+		i, _ := strconv.ParseInt(value, 10, 64)
+		return strconv.FormatInt(i, 10)
+	case "float":
+		f, _ := strconv.ParseFloat(value, 64)
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	case "bool":
+		b, _ := strconv.ParseBool(value)
+		return strconv.FormatBool(b)
+	case "duration":
+		d, _ := time.ParseDuration(value)
+		return durationLiteral(d)
+	}
+	return strconv.Quote(value)
+}
+
+var durationUnits = []struct {
+	unit time.Duration
+	name string
+}{
+	{time.Hour, "time.Hour"},
+	{time.Minute, "time.Minute"},
+	{time.Second, "time.Second"},
+	{time.Millisecond, "time.Millisecond"},
+	{time.Microsecond, "time.Microsecond"},
+	{time.Nanosecond, "time.Nanosecond"},
+}
+
+// durationLiteral returns d as a readable Go expression, like time.Second * 10
+func durationLiteral(d time.Duration) string {
+	if d == 0 {
+		return "0"
+	}
+	for _, u := range durationUnits {
+		if d%u.unit != 0 {
+			continue
+		}
+		if d == u.unit {
+			return u.name
+		}
+		return fmt.Sprintf("%s * %d", u.name, d/u.unit)
+	}
+	return strconv.FormatInt(int64(d), 10)
+}
+
+func check(k keySchema, v validator) checkView {
+	switch v.name {
+	case "min":
+		return checkView{
+			Failed:  "v < " + literal(k.Type, v.value),
+			Message: strconv.Quote(k.Key + " must be at least " + v.value + ", not "),
+		}
+	case "max":
+		return checkView{
+			Failed:  "v > " + literal(k.Type, v.value),
+			Message: strconv.Quote(k.Key + " must be at most " + v.value + ", not "),
+		}
+	case "oneof":
+		options := strings.Split(v.value, "|")
+		conds := make([]string, 0, len(options))
+		for _, option := range options {
+			conds = append(conds, "v != "+literal(k.Type, option))
+		}
+		return checkView{
+			Failed:  strings.Join(conds, " && "),
+			Message: strconv.Quote(k.Key + " must be one of " + strings.Join(options, ", ") + ", not "),
+		}
+	}
+	return checkView{
+		Failed:  `v == ""`,
+		Message: strconv.Quote(k.Key + " must not be empty, not "),
+	}
+}
+
+// commentLines returns s as the rest of a field's doc comment, starting every following line with //
+func commentLines(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+		if i > 0 && lines[i] != "" {
+			lines[i] = " " + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n\t//")
+}
+
+// cell escapes s so it stays inside one markdown table cell
+func cell(s string) string {
+	s = strings.Replace(strings.TrimSpace(s), "|", `\|`, -1)
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	return strings.Replace(s, "\n", "<br>", -1)
+}
+
+var codeTemplate = template.Must(template.New("code").Funcs(template.FuncMap{
+	"comment": commentLines,
+}).Parse(`// Code generated by distconf-gen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+{{- if .HasChecks}}
+	"errors"
+	"fmt"
+	"strings"
+{{- end}}
+{{- if .NeedsTime}}
+	"time"
+{{- end}}
+
+	"{{.ImportPath}}"
+)
+
+// {{.Type}} holds every config variable
+type {{.Type}} struct {
+{{- range .Keys}}
+	// {{.Name}} is the {{.Key}} config variable.{{if .Description}}  {{comment .Description}}{{end}}
+	{{.Name}} *distconf.{{.DistconfType}}
+{{- end}}
+}
+
+// New{{.Type}} registers every variable of {{.Type}} with conf
+func New{{.Type}}(ctx context.Context, conf *distconf.Distconf) *{{.Type}} {
+	return &{{.Type}}{
+{{- range .Keys}}
+		{{.Name}}: conf.{{.DistconfType}}(ctx, {{printf "%q" .Key}}, {{.DefaultLiteral}}),
+{{- end}}
+	}
+}
+
+// Validate returns an error listing every variable with an invalid current value
+func (c *{{.Type}}) Validate() error {
+{{- if .HasChecks}}
+	var errs []string
+{{- range $key := .Keys}}
+{{- range .Checks}}
+	if v := c.{{$key.Name}}.Get(); {{.Failed}} {
+		errs = append(errs, {{.Message}}+fmt.Sprint(v))
+	}
+{{- end}}
+{{- end}}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(errs, "; "))
+{{- else}}
+	return nil
+{{- end}}
+}
+`))
+
+var testTemplate = template.Must(template.New("test").Parse(`// Code generated by distconf-gen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+	"testing"
+{{- if .TestNeedsTime}}
+	"time"
+{{- end}}
+
+	"{{.ImportPath}}"
+)
+
+func TestNew{{.Type}}_defaults(t *testing.T) {
+	c := New{{.Type}}(context.Background(), &distconf.Distconf{})
+{{- range .Keys}}
+	if v := c.{{.Name}}.Get(); v != {{.DefaultLiteral}} {
+		t.Errorf("%s defaults to %v", {{printf "%q" .Key}}, v)
+	}
+{{- end}}
+}
+`))
+
+var docsTemplate = template.Must(template.New("docs").Funcs(template.FuncMap{
+	"cell": cell,
+}).Parse(`# {{.Type}}
+
+Generated by distconf-gen.
+
+| Key | Type | Default | Validation | Description |
+|---|---|---|---|---|
+{{- range .Keys}}
+| ` + "`{{.Key}}`" + ` | {{.Type}} | {{if .Default}}` + "`{{cell .Default}}`" + `{{end}} | {{cell .Validate}} | {{cell .Description}} |
+{{- end}}
+`))
+
+// generate returns the code, test and markdown docs of s
+func generate(s *schema, importPath string) (code []byte, test []byte, docs []byte, err error) {
+	v := newView(s, importPath)
+	if code, err = render(codeTemplate, v, true); err != nil {
+		return nil, nil, nil, err
+	}
+	if test, err = render(testTemplate, v, true); err != nil {
+		return nil, nil, nil, err
+	}
+	if docs, err = render(docsTemplate, v, false); err != nil {
+		return nil, nil, nil, err
+	}
+	return code, test, docs, nil
+}
+
+func render(t *template.Template, v *view, isGo bool) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, v); err != nil {
+		return nil, err
+	}
+	if !isGo {
+		return buf.Bytes(), nil
+	}
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated invalid Go: %v", err)
+	}
+	return formatted, nil
+}
@@ -0,0 +1,89 @@
+// Command distconf-gen generates a Go package of typed distconf variables from a schema, so code can use config
+// without registering keys by hand or using reflection.
+//
+// The schema is either YAML:
+//
+//	package: config
+//	type: Config
+//	keys:
+//	  - key: server.port
+//	    type: int
+//	    default: 8080
+//	    description: Port to listen on
+//	    validate: min=1,max=65535
+//
+// or a Go file with a struct that uses the tags of distconf.Bind, plus desc and validate tags:
+//
+//	type Config struct {
+//	    Port *distconf.Int `distconf:"server.port,default=8080" desc:"Port to listen on" validate:"min=1,max=65535"`
+//	}
+//
+// An empty key uses the field name.  The generated struct has the same name as the schema struct, so keep a Go
+// schema out of the generated package, or behind a build tag like ignore.
+//
+// Types are int, float, str, bool and duration.  Validators are min=X and max=X for int, float and duration,
+// oneof=a|b for int and str, and nonempty for str.
+//
+// distconf-gen writes a struct with a constructor and a Validate method, a test of the defaults, and markdown
+// docs of every key.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("distconf-gen", flag.ContinueOnError)
+	schemaPath := fs.String("schema", "", "YAML or Go file describing the config keys")
+	out := fs.String("out", ".", "directory to write the generated package to")
+	pkg := fs.String("package", "", "package of the generated code.  Overrides the schema")
+	typeName := fs.String("type", "", "name of the generated struct, and of the struct to read from a Go schema")
+	importPath := fs.String("import", "github.com/cep21/distconf", "import path of distconf")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *schemaPath == "" {
+		return fmt.Errorf("missing -schema")
+	}
+	s, err := loadSchema(*schemaPath, *typeName)
+	if err != nil {
+		return err
+	}
+	if *pkg != "" {
+		s.Package = *pkg
+	}
+	if err := s.check(); err != nil {
+		return err
+	}
+	code, test, docs, err := generate(s, *importPath)
+	if err != nil {
+		return err
+	}
+	base := filepath.Join(*out, strings.ToLower(s.Type))
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		return err
+	}
+	files := map[string][]byte{
+		base + "_gen.go":      code,
+		base + "_gen_test.go": test,
+		base + ".md":          docs,
+	}
+	for path, contents := range files {
+		if err := ioutil.WriteFile(path, contents, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const yamlSchema = `package: config
+keys:
+  - key: server.port
+    type: int
+    default: 8080
+    description: Port to listen on
+    validate: min=1,max=65535
+  - key: server.host
+    type: string
+    default: localhost
+    validate: nonempty
+  - key: mode
+    type: str
+    default: fast
+    validate: oneof=fast|slow
+  - key: timeout
+    type: duration
+    default: 1m30s
+  - key: debug
+    type: bool
+`
+
+const goSchema = `package schema
+
+import (
+	"time"
+
+	"github.com/cep21/distconf"
+)
+
+type Other int
+
+type Settings struct {
+	Port    *distconf.Int ` + "`" + `distconf:"port,default=80" validate:"min=1"` + "`" + `
+	Timeout time.Duration ` + "`" + `distconf:"timeout,default=1s" desc:"How long to wait"` + "`" + `
+	Name    string        ` + "`" + `distconf:""` + "`" + `
+	Ignored string
+	Skipped string        ` + "`" + `distconf:"-"` + "`" + `
+}
+`
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "distconf-gen")
+	require.NoError(t, err)
+	return dir, func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}
+}
+
+func writeSchema(t *testing.T, dir string, name string, contents string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	return path
+}
+
+// readGenerated returns a generated file, after checking it parses if it is Go
+func readGenerated(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	if filepath.Ext(path) == ".go" {
+		_, err = parser.ParseFile(token.NewFileSet(), path, b, 0)
+		require.NoError(t, err)
+	}
+	return string(b)
+}
+
+// genDir returns a directory inside this module, so generated code can be built against this copy of distconf.  It
+// is under testdata, so ./... never includes it.
+func genDir(t *testing.T) (string, func()) {
+	require.NoError(t, os.MkdirAll("testdata", 0755))
+	dir, err := ioutil.TempDir("testdata", "gen")
+	require.NoError(t, err)
+	return dir, func() {
+		require.NoError(t, os.RemoveAll(dir))
+		// Only removes testdata if nothing else is in it
+		_ = os.Remove("testdata")
+	}
+}
+
+// buildGenerated vets the generated package in dir and runs its generated test
+func buildGenerated(t *testing.T, dir string) {
+	if testing.Short() {
+		t.Skip("building generated code is slow")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not installed")
+	}
+	for _, args := range [][]string{{"vet", "."}, {"test", "-count=1", "."}} {
+		cmd := exec.Command(goBin, args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "go %v: %s", args, out)
+	}
+}
+
+func TestRun_build(t *testing.T) {
+	schemaDir, cleanup := tempDir(t)
+	defer cleanup()
+	for name, args := range map[string][]string{
+		"yaml": {"-schema", writeSchema(t, schemaDir, "schema.yaml", yamlSchema)},
+		"go":   {"-schema", writeSchema(t, schemaDir, "schema.go", goSchema), "-package", "settings"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir, cleanup := genDir(t)
+			defer cleanup()
+			require.NoError(t, run(append(args, "-out", dir, "-import", "github.com/cep21/distconf")))
+			buildGenerated(t, dir)
+		})
+	}
+}
+
+func TestRun_yaml(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	out := filepath.Join(dir, "out")
+	require.NoError(t, run([]string{"-schema", writeSchema(t, dir, "schema.yaml", yamlSchema), "-out", out}))
+
+	code := readGenerated(t, filepath.Join(out, "config_gen.go"))
+	assert.Contains(t, code, "package config")
+	assert.Contains(t, code, "func NewConfig(ctx context.Context, conf *distconf.Distconf) *Config")
+	assert.Contains(t, code, `ServerPort: conf.Int(ctx, "server.port", 8080)`)
+	assert.Contains(t, code, `ServerHost: conf.Str(ctx, "server.host", "localhost")`)
+	assert.Contains(t, code, `Timeout:    conf.Duration(ctx, "timeout", time.Second*90)`)
+	assert.Contains(t, code, `Debug:      conf.Bool(ctx, "debug", false)`)
+	assert.Contains(t, code, "// ServerPort is the server.port config variable.  Port to listen on")
+	assert.Contains(t, code, "if v := c.ServerPort.Get(); v > 65535 {")
+	assert.Contains(t, code, `if v := c.ServerHost.Get(); v == "" {`)
+	assert.Contains(t, code, `if v := c.Mode.Get(); v != "fast" && v != "slow" {`)
+
+	test := readGenerated(t, filepath.Join(out, "config_gen_test.go"))
+	assert.Contains(t, test, "func TestNewConfig_defaults(t *testing.T)")
+	assert.Contains(t, test, "if v := c.Timeout.Get(); v != time.Second*90 {")
+
+	docs := readGenerated(t, filepath.Join(out, "config.md"))
+	assert.Contains(t, docs, "| `server.port` | int | `8080` | min=1,max=65535 | Port to listen on |")
+	assert.Contains(t, docs, "| `mode` | str | `fast` | oneof=fast\\|slow |  |")
+}
+
+func TestRun_multilineDescription(t *testing.T) {
+	schemaDir, cleanup := tempDir(t)
+	defer cleanup()
+	dir, cleanup := genDir(t)
+	defer cleanup()
+	schemaPath := writeSchema(t, schemaDir, "schema.yaml", `package: config
+keys:
+  - key: retries
+    type: int
+    default: 3
+    description: |
+      How many times to retry.
+
+      Zero disables retries | use with care
+`)
+	require.NoError(t, run([]string{"-schema", schemaPath, "-out", dir, "-import", "github.com/cep21/distconf"}))
+
+	code := readGenerated(t, filepath.Join(dir, "config_gen.go"))
+	assert.Contains(t, code, "\t// Retries is the retries config variable.  How many times to retry.\n"+
+		"\t//\n"+
+		"\t// Zero disables retries | use with care\n"+
+		"\tRetries *distconf.Int\n")
+	docs := readGenerated(t, filepath.Join(dir, "config.md"))
+	assert.Contains(t, docs, "| `retries` | int | `3` |  | "+
+		"How many times to retry.<br><br>Zero disables retries \\| use with care |\n")
+	buildGenerated(t, dir)
+}
+
+func TestRun_goSchema(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	schemaPath := writeSchema(t, dir, "schema.go", goSchema)
+	require.NoError(t, run([]string{"-schema", schemaPath, "-out", dir, "-package", "settings", "-type", "Settings"}))
+
+	code := readGenerated(t, filepath.Join(dir, "settings_gen.go"))
+	assert.Contains(t, code, "package settings")
+	assert.Contains(t, code, `Port:    conf.Int(ctx, "port", 80)`)
+	assert.Contains(t, code, `Timeout: conf.Duration(ctx, "timeout", time.Second)`)
+	assert.Contains(t, code, `Name:    conf.Str(ctx, "Name", "")`)
+	assert.Contains(t, code, "How long to wait")
+	assert.NotContains(t, code, "Ignored")
+	assert.NotContains(t, code, "Skipped")
+
+	// Without -type, the first struct is used
+	s, err := loadSchema(schemaPath, "")
+	require.NoError(t, err)
+	assert.Equal(t, "Settings", s.Type)
+	assert.Equal(t, "schema", s.Package)
+}
+
+func TestRun_errors(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	assert.Error(t, run(nil))
+	assert.Error(t, run([]string{"-unknown"}))
+	assert.Error(t, run([]string{"-schema", filepath.Join(dir, "missing.yaml")}))
+	assert.Error(t, run([]string{"-schema", filepath.Join(dir, "missing.go")}))
+
+	schemas := map[string]string{
+		"bad yaml":          "keys: [",
+		"unknown field":     "package: config\nunknown: true\n",
+		"no package":        "keys:\n  - key: a\n    type: int\n",
+		"no key":            "package: config\nkeys:\n  - type: int\n",
+		"bad type":          "package: config\nkeys:\n  - key: a\n    type: list\n",
+		"bad default":       "package: config\nkeys:\n  - key: a\n    type: int\n    default: abc\n",
+		"duplicate key":     "package: config\nkeys:\n  - key: a\n    type: int\n  - key: a\n    type: int\n",
+		"duplicate name":    "package: config\nkeys:\n  - key: a.b\n    type: int\n  - key: a_b\n    type: int\n",
+		"unknown validator": "package: config\nkeys:\n  - key: a\n    type: int\n    validate: even\n",
+		"bad min":           "package: config\nkeys:\n  - key: a\n    type: int\n    validate: min=abc\n",
+		"min on str":        "package: config\nkeys:\n  - key: a\n    type: str\n    validate: min=1\n",
+		"oneof on bool":     "package: config\nkeys:\n  - key: a\n    type: bool\n    validate: oneof=true\n",
+		"bad oneof":         "package: config\nkeys:\n  - key: a\n    type: int\n    validate: oneof=1|b\n",
+		"nonempty on int":   "package: config\nkeys:\n  - key: a\n    type: int\n    validate: nonempty\n",
+	}
+	for name, contents := range schemas {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, run([]string{"-schema", writeSchema(t, dir, "schema.yaml", contents), "-out", dir}))
+		})
+	}
+
+	goSchemas := map[string]string{
+		"no struct":      "package schema\n",
+		"bad go":         "package schema\ntype {",
+		"bad field type": "package schema\ntype C struct {\n\tA []string `distconf:\"a\"`\n}\n",
+		"bad option":     "package schema\ntype C struct {\n\tA int `distconf:\"a,required\"`\n}\n",
+	}
+	for name, contents := range goSchemas {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, run([]string{"-schema", writeSchema(t, dir, "schema.go", contents), "-out", dir, "-package", "p"}))
+		})
+	}
+}
+
+func TestFieldName(t *testing.T) {
+	assert.Equal(t, "DbMaxConns", fieldName("db.max_conns"))
+	assert.Equal(t, "Key2fa", fieldName("2fa"))
+	assert.Equal(t, "Key", fieldName("..."))
+}
+
+func TestDurationLiteral(t *testing.T) {
+	assert.Equal(t, "0", durationLiteral(0))
+	assert.Equal(t, "time.Hour", durationLiteral(time.Hour))
+	assert.Equal(t, "time.Millisecond * 1500", durationLiteral(1500*time.Millisecond))
+	assert.Equal(t, "time.Nanosecond * 3", durationLiteral(3))
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// schema describes the config struct to generate
+type schema struct {
+	// Package of the generated code
+	Package string `yaml:"package"`
+	// Type is the name of the generated struct
+	Type string      `yaml:"type"`
+	Keys []keySchema `yaml:"keys"`
+}
+
+// keySchema is a single config key
+type keySchema struct {
+	Key string `yaml:"key"`
+	// Name of the struct field.  Defaults to the key in CamelCase
+	Name string `yaml:"name"`
+	// Type is one of int, float, str, bool or duration
+	Type        string `yaml:"type"`
+	Default     string `yaml:"default"`
+	Description string `yaml:"description"`
+	// Validate is a comma separated list of min=X, max=X, oneof=a|b and nonempty
+	Validate string `yaml:"validate"`
+
+	validators []validator
+}
+
+// validator is a single check of a key's value
+type validator struct {
+	name  string
+	value string
+}
+
+var distconfTypes = map[string]string{
+	"int":      "Int",
+	"float":    "Float",
+	"str":      "Str",
+	"bool":     "Bool",
+	"duration": "Duration",
+}
+
+// loadSchema reads a YAML schema, or a Go struct schema if path ends in .go
+func loadSchema(path string, typeName string) (*schema, error) {
+	if strings.HasSuffix(path, ".go") {
+		return loadGoSchema(path, typeName)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s schema
+	if err := yaml.UnmarshalStrict(b, &s); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", path, err)
+	}
+	if typeName != "" {
+		s.Type = typeName
+	}
+	return &s, nil
+}
+
+// loadGoSchema reads the struct typeName, or the first struct, of a Go file.  Fields use the same distconf tag as
+// Distconf.Bind, plus desc and validate tags.
+func loadGoSchema(path string, typeName string) (*schema, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	var found *ast.StructType
+	s := &schema{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		spec, ok := n.(*ast.TypeSpec)
+		if !ok || found != nil {
+			return found == nil
+		}
+		st, ok := spec.Type.(*ast.StructType)
+		if !ok || (typeName != "" && spec.Name.Name != typeName) {
+			return true
+		}
+		found = st
+		s.Type = spec.Name.Name
+		return false
+	})
+	if found == nil {
+		return nil, fmt.Errorf("no struct %s in %s", typeName, path)
+	}
+	s.Package = f.Name.Name
+	for _, field := range found.Fields.List {
+		if field.Tag == nil {
+			continue
+		}
+		tagValue, err := strconv.Unquote(field.Tag.Value)
+		if err != nil {
+			return nil, err
+		}
+		tag := reflect.StructTag(tagValue)
+		distconfTag, exists := tag.Lookup("distconf")
+		if !exists || distconfTag == "-" {
+			continue
+		}
+		keyType, err := goFieldType(field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fset.Position(field.Pos()), err)
+		}
+		parts := strings.SplitN(distconfTag, ",", 2)
+		k := keySchema{
+			Key:         parts[0],
+			Type:        keyType,
+			Description: tag.Get("desc"),
+			Validate:    tag.Get("validate"),
+		}
+		if len(parts) == 2 {
+			if !strings.HasPrefix(parts[1], "default=") {
+				return nil, fmt.Errorf("%s: unknown tag option %s", fset.Position(field.Pos()), parts[1])
+			}
+			k.Default = strings.TrimPrefix(parts[1], "default=")
+		}
+		for _, name := range field.Names {
+			k.Name = name.Name
+			if parts[0] == "" {
+				// Like Bind, an empty key uses the field name
+				k.Key = name.Name
+			}
+			s.Keys = append(s.Keys, k)
+		}
+	}
+	return s, nil
+}
+
+// goFieldType maps the Go type of a struct field to a schema type
+func goFieldType(expr ast.Expr) (string, error) {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch t := expr.(type) {
+	case *ast.Ident:
+		switch t.Name {
+		case "int", "int8", "int16", "int32", "int64":
+			return "int", nil
+		case "float32", "float64":
+			return "float", nil
+		case "string":
+			return "str", nil
+		case "bool":
+			return "bool", nil
+		}
+	case *ast.SelectorExpr:
+		if pkg, ok := t.X.(*ast.Ident); ok {
+			if pkg.Name == "time" && t.Sel.Name == "Duration" {
+				return "duration", nil
+			}
+			if pkg.Name == "distconf" {
+				for schemaType, distconfType := range distconfTypes {
+					if distconfType == t.Sel.Name {
+						return schemaType, nil
+					}
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("unsupported field type %T", expr)
+}
+
+// check fills in defaults and verifies every key
+func (s *schema) check() error {
+	if s.Package == "" {
+		return fmt.Errorf("missing package")
+	}
+	if s.Type == "" {
+		s.Type = "Config"
+	}
+	keys := make(map[string]struct{}, len(s.Keys))
+	names := make(map[string]struct{}, len(s.Keys))
+	for i := range s.Keys {
+		k := &s.Keys[i]
+		if k.Key == "" {
+			return fmt.Errorf("key %d has no key", i)
+		}
+		if _, exists := keys[k.Key]; exists {
+			return fmt.Errorf("key %s is duplicated", k.Key)
+		}
+		keys[k.Key] = struct{}{}
+		if k.Type == "string" {
+			k.Type = "str"
+		}
+		if _, exists := distconfTypes[k.Type]; !exists {
+			return fmt.Errorf("key %s has unknown type %q", k.Key, k.Type)
+		}
+		if k.Name == "" {
+			k.Name = fieldName(k.Key)
+		}
+		if _, exists := names[k.Name]; exists {
+			return fmt.Errorf("key %s has duplicated name %s", k.Key, k.Name)
+		}
+		names[k.Name] = struct{}{}
+		if k.Default != "" {
+			if err := checkValue(k.Type, k.Default); err != nil {
+				return fmt.Errorf("key %s has invalid default: %v", k.Key, err)
+			}
+		}
+		validators, err := parseValidators(k.Type, k.Validate)
+		if err != nil {
+			return fmt.Errorf("key %s: %v", k.Key, err)
+		}
+		k.validators = validators
+	}
+	return nil
+}
+
+// fieldName turns a key like db.max_conns into DbMaxConns
+func fieldName(key string) string {
+	parts := strings.FieldsFunc(key, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var ret strings.Builder
+	for _, part := range parts {
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		ret.WriteString(string(runes))
+	}
+	name := ret.String()
+	if name == "" || unicode.IsDigit([]rune(name)[0]) {
+		name = "Key" + name
+	}
+	return name
+}
+
+// checkValue returns an error if value cannot be parsed as keyType
+func checkValue(keyType string, value string) error {
+	var err error
+	switch keyType {
+	case "int":
+		_, err = strconv.ParseInt(value, 10, 64)
+	case "float":
+		_, err = strconv.ParseFloat(value, 64)
+	case "bool":
+		_, err = strconv.ParseBool(value)
+	case "duration":
+		_, err = time.ParseDuration(value)
+	}
+	return err
+}
+
+// parseValidators parses a validate string like min=1,max=10
+func parseValidators(keyType string, validate string) ([]validator, error) {
+	if validate == "" {
+		return nil, nil
+	}
+	var ret []validator
+	for _, part := range strings.Split(validate, ",") {
+		parts := strings.SplitN(part, "=", 2)
+		v := validator{name: strings.TrimSpace(parts[0])}
+		if len(parts) == 2 {
+			v.value = strings.TrimSpace(parts[1])
+		}
+		switch v.name {
+		case "min", "max":
+			if keyType != "int" && keyType != "float" && keyType != "duration" {
+				return nil, fmt.Errorf("%s only works on int, float and duration", v.name)
+			}
+			if err := checkValue(keyType, v.value); err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", v.name, err)
+			}
+		case "oneof":
+			if keyType != "int" && keyType != "str" {
+				return nil, fmt.Errorf("oneof only works on int and str")
+			}
+			for _, option := range strings.Split(v.value, "|") {
+				if err := checkValue(keyType, option); err != nil {
+					return nil, fmt.Errorf("invalid oneof: %v", err)
+				}
+			}
+		case "nonempty":
+			if keyType != "str" {
+				return nil, fmt.Errorf("nonempty only works on str")
+			}
+		default:
+			return nil, fmt.Errorf("unknown validator %s", v.name)
+		}
+		ret = append(ret, v)
+	}
+	return ret, nil
+}
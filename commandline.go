@@ -2,28 +2,299 @@ package distconf
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"reflect"
+	"sort"
 	"strings"
 )
 
+// CommandLine reads Prefix+key=value arguments.  If Prefix is not empty, it also reads, with a Prefix of --,
+//
+//	--key value     a value in the next argument, if that argument is not a flag itself
+//	--key           a bare flag, which is "true"
+//	--no-key        a negated bare flag, which is "false".  It never takes the next argument as its value.
+//	-k value        a short alias of Short, with the same forms as the long flag
+//	--              the end of the flags.  Later arguments are never read.
+//
+// A key given many times is read as its first value, unless the key is in Lists.  Keys in Lists are read as every
+// value joined by ListSeparator, so lists can be passed as repeated flags.  Use Prefix+key=value, or put positional
+// arguments after --, when a bare flag is followed by a positional argument.
+//
+// Reading never fails on an argument.  --help and unknown arguments are only handled if Check(conf) is called once
+// every key is registered, so call it at startup.
 type CommandLine struct {
 	Prefix string
 	Source []string
+	// Output is where Check writes help.  Defaults to os.Stderr.
+	Output io.Writer
+	// Short maps short aliases to keys, like "v" to "verbose" so -v is read as --verbose.
+	Short map[string]string
+	// Lists are the keys that are read as every value of a repeated key, instead of the first one.
+	Lists []string
+	// ListSeparator joins the values of a repeated key in Lists.  Defaults to ",".
+	ListSeparator string
 }
 
 var _ Reader = &CommandLine{}
+var _ Lister = &CommandLine{}
 
-func (p *CommandLine) Read(_ context.Context, key string) ([]byte, error) {
+// ErrHelp is returned by CommandLine.Check when the arguments ask for help
+var ErrHelp = errors.New("help requested")
+
+var errUnknownArgument = errors.New("unknown command line argument")
+
+// commandLineArg is a single key and value parsed from the arguments
+type commandLineArg struct {
+	key   string
+	value string
+	// negates is the key of a bare Prefix+"no-"+key argument.  The argument is read as negates set to false, and as
+	// key set to true.
+	negates string
+}
+
+func (p *CommandLine) source() []string {
 	if p.Source == nil {
 		p.Source = os.Args
 	}
-	argPrefix := p.Prefix + key + "="
-	for _, arg := range p.Source {
-		if !strings.HasPrefix(arg, argPrefix) {
+	return p.Source
+}
+
+func (p *CommandLine) listSeparator() string {
+	if p.ListSeparator == "" {
+		return ","
+	}
+	return p.ListSeparator
+}
+
+// parse every flag of the arguments, in order
+func (p *CommandLine) parse() []commandLineArg {
+	source := p.source()
+	var ret []commandLineArg
+	for i := 0; i < len(source); i++ {
+		if source[i] == "--" && p.Prefix != "" {
+			break
+		}
+		key, value, hasValue, ok := p.splitArg(source[i])
+		if !ok || (!hasValue && p.Prefix == "") {
+			continue
+		}
+		if !hasValue {
+			switch {
+			case strings.HasPrefix(key, "no-") && len(key) > len("no-"):
+				ret = append(ret, commandLineArg{key: key, value: "true", negates: key[len("no-"):]})
+				continue
+			case i+1 < len(source) && source[i+1] != "--" && !p.isFlag(source[i+1]):
+				i++
+				value = source[i]
+			default:
+				value = "true"
+			}
+		}
+		ret = append(ret, commandLineArg{key: key, value: value})
+	}
+	return ret
+}
+
+// splitArg returns the key of a flag, and its value if it is in the same argument.  ok is false if arg is not a
+// flag.
+func (p *CommandLine) splitArg(arg string) (key string, value string, hasValue bool, ok bool) {
+	if strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") {
+		name, value, hasValue := splitValue(arg[len("-"):])
+		if key, exists := p.Short[name]; exists {
+			return key, value, hasValue, key != ""
+		}
+	}
+	if !strings.HasPrefix(arg, p.Prefix) {
+		return "", "", false, false
+	}
+	key, value, hasValue = splitValue(arg[len(p.Prefix):])
+	return key, value, hasValue, key != ""
+}
+
+// splitValue splits a name=value argument
+func splitValue(arg string) (string, string, bool) {
+	if equals := strings.Index(arg, "="); equals != -1 {
+		return arg[:equals], arg[equals+1:], true
+	}
+	return arg, "", false
+}
+
+func (p *CommandLine) isFlag(arg string) bool {
+	_, _, _, ok := p.splitArg(arg)
+	return ok
+}
+
+func (p *CommandLine) isList(key string) bool {
+	for _, list := range p.Lists {
+		if list == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *CommandLine) Read(_ context.Context, key string) ([]byte, error) {
+	isList := p.isList(key)
+	var values []string
+	for _, arg := range p.parse() {
+		if arg.key == key {
+			values = append(values, arg.value)
+		} else if arg.negates != "" && arg.negates == key {
+			values = append(values, "false")
+		} else {
+			continue
+		}
+		if !isList {
+			break
+		}
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return []byte(strings.Join(values, p.listSeparator())), nil
+}
+
+// List returns the key of every flag where key starts with prefix.  The key of --no-key is key.
+func (p *CommandLine) List(_ context.Context, prefix string) ([]string, error) {
+	seen := make(map[string]struct{})
+	var ret []string
+	for _, arg := range p.parse() {
+		key := arg.key
+		if arg.negates != "" {
+			key = arg.negates
+		}
+		if !strings.HasPrefix(key, prefix) {
 			continue
 		}
-		argSuffix := arg[len(argPrefix):]
-		return []byte(argSuffix), nil
+		if _, exists := seen[key]; !exists {
+			seen[key] = struct{}{}
+			ret = append(ret, key)
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// Check the arguments against the keys registered with conf.  Call it once every key is registered.
+//
+// If an argument is Prefix+"help", and no key named help is registered, Check writes the help of every key to
+// Output and returns ErrHelp.  Otherwise, every argument that starts with Prefix but is not a registered key or
+// alias is reported to Hooks.OnError and returned in a KeyErrors, so misspelled arguments are not silently ignored.
+// Unknown arguments are only reported if Prefix is not empty.
+func (p *CommandLine) Check(conf *Distconf) error {
+	keys := conf.describeKeys()
+	known := make(map[string]struct{}, len(keys))
+	for _, d := range keys {
+		known[d.key] = struct{}{}
+		for _, alias := range d.options.aliases {
+			known[alias] = struct{}{}
+		}
+	}
+	errs := make(KeyErrors)
+	for _, arg := range p.parse() {
+		key := arg.key
+		if _, exists := known[key]; exists {
+			continue
+		}
+		if _, exists := known[arg.negates]; exists && arg.negates != "" {
+			continue
+		}
+		if key == "help" {
+			output := p.Output
+			if output == nil {
+				output = os.Stderr
+			}
+			readers, _ := conf.currentReaders()
+			if err := p.writeHelp(output, keys, readers); err != nil {
+				return err
+			}
+			return ErrHelp
+		}
+		if _, exists := errs[key]; !exists && p.Prefix != "" {
+			conf.Hooks.onError("Unknown command line argument", key, errUnknownArgument)
+			errs[key] = errUnknownArgument
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// WriteHelp writes every key registered with conf, sorted, with its type, default, description and the Reader of
+// its current value
+func (p *CommandLine) WriteHelp(w io.Writer, conf *Distconf) error {
+	readers, _ := conf.currentReaders()
+	return p.writeHelp(w, conf.describeKeys(), readers)
+}
+
+func (p *CommandLine) writeHelp(w io.Writer, keys []keyDescription, readers []Reader) error {
+	for _, d := range keys {
+		defaultValue := fmt.Sprint(d.defaultValue)
+		if d.distType == strType {
+			defaultValue = fmt.Sprintf("%q", d.defaultValue)
+		}
+		source := "default"
+		if d.source != nil {
+			source = describeSource(readers, d.source)
+		}
+		details := []string{"default " + defaultValue, "source " + source}
+		if len(d.options.aliases) != 0 {
+			details = append(details, "aliases "+strings.Join(d.options.aliases, ", "))
+		}
+		if d.options.deprecated {
+			deprecated := "deprecated"
+			if d.options.replacementKey != "" {
+				deprecated += ": use " + p.Prefix + d.options.replacementKey
+			}
+			details = append(details, deprecated)
+		}
+		help := fmt.Sprintf("  %s%s %s\n", p.Prefix, d.key, distTypeNames[d.distType])
+		if d.options.description != "" {
+			help += "    \t" + d.options.description + "\n"
+		}
+		help += "    \t(" + strings.Join(details, ", ") + ")\n"
+		if _, err := io.WriteString(w, help); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// describeSource names r for help by its index in readers and its type, with its Prefix or Name if it has one, so
+// Readers of the same type can be told apart
+func describeSource(readers []Reader, r Reader) string {
+	ret := fmt.Sprintf("%T", r)
+	for i, existing := range readers {
+		if sameInstance(existing, r) {
+			ret = fmt.Sprintf("Readers[%d] %s", i, ret)
+			break
+		}
+	}
+	if label := readerLabel(r); label != "" {
+		ret += " " + label
+	}
+	return ret
+}
+
+// readerLabel returns prefix=Prefix or name=Name of r, or of the Reader it wraps, if it has a non empty string field
+// with that name
+func readerLabel(r Reader) string {
+	for {
+		if v := reflect.Indirect(reflect.ValueOf(r)); v.Kind() == reflect.Struct {
+			for _, field := range []string{"Prefix", "Name"} {
+				if f := v.FieldByName(field); f.Kind() == reflect.String && f.String() != "" {
+					return strings.ToLower(field) + "=" + f.String()
+				}
+			}
+		}
+		w, ok := r.(wrapper)
+		if !ok {
+			return ""
+		}
+		r = w.wrapped()
 	}
-	return nil, nil
 }
@@ -1,11 +1,14 @@
 package distconf
 
 import (
+	"bytes"
 	"context"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCommandLine_Read_prefix(t *testing.T) {
@@ -31,3 +34,185 @@ func TestCommandLine_Read_defaults(t *testing.T) {
 	var expected []byte
 	assert.Equal(t, expected, b)
 }
+
+func TestCommandLine_List(t *testing.T) {
+	l := CommandLine{
+		Prefix: "--",
+		Source: []string{"cmd", "--port=1", "--db.host=a", "--port=2", "--flag", "-x=1", "--no-cache", "--", "--after=1"},
+	}
+	keys, err := l.List(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cache", "db.host", "flag", "port"}, keys)
+	keys, err = l.List(context.Background(), "db.")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"db.host"}, keys)
+}
+
+func TestCommandLine_Read_forms(t *testing.T) {
+	l := CommandLine{
+		Prefix: "--",
+		Source: []string{
+			"cmd", "positional",
+			"--port", "8080",
+			"--verbose",
+			"--no-cache",
+			"--offset", "-5",
+			"--tag=a", "--tag", "b", "-t", "c", "-t=d",
+			"-v", "--debug", "-n", "--empty=",
+			"--", "--after=1", "--port=1",
+		},
+		Short: map[string]string{"t": "tag", "v": "level", "n": "dry-run"},
+		Lists: []string{"tag"},
+	}
+	for key, expected := range map[string]string{
+		"port":     "8080",
+		"verbose":  "true",
+		"cache":    "false",
+		"no-cache": "true",
+		"offset":   "-5",
+		"tag":      "a,b,c,d",
+		"level":    "true",
+		"debug":    "true",
+		"dry-run":  "true",
+		"empty":    "",
+	} {
+		b, err := l.Read(context.Background(), key)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(expected), b, key)
+	}
+	for _, missing := range []string{"after", "positional", "cmd", "t", "v"} {
+		b, err := l.Read(context.Background(), missing)
+		assert.NoError(t, err)
+		assert.Nil(t, b, missing)
+	}
+
+	// A negation never takes the next argument, and a flag is never a value
+	l.Source = []string{"--no-verbose", "file", "--name", "--port", "1"}
+	b, err := l.Read(context.Background(), "verbose")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("false"), b)
+	b, err = l.Read(context.Background(), "name")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("true"), b)
+
+	l.Source = []string{"--tag=a", "--tag=b"}
+	l.ListSeparator = ";"
+	b, err = l.Read(context.Background(), "tag")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a;b"), b)
+
+	// Keys that are not lists read their first value
+	l.Source = []string{"--port=1", "--port", "2", "--no-cache", "--cache"}
+	b, err = l.Read(context.Background(), "port")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("1"), b)
+	b, err = l.Read(context.Background(), "cache")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("false"), b)
+}
+
+func TestCommandLine_Read_noPrefix(t *testing.T) {
+	// Without a prefix there is no way to tell flags from values, so only key=value is read
+	l := CommandLine{
+		Source: []string{"cmd", "port=1", "verbose", "--", "host=a"},
+	}
+	for key, expected := range map[string][]byte{"port": []byte("1"), "verbose": nil, "cmd": nil, "host": []byte("a")} {
+		b, err := l.Read(context.Background(), key)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, b, key)
+	}
+}
+
+func TestCommandLine_Read_distconf(t *testing.T) {
+	ctx := context.Background()
+	conf := &Distconf{Readers: []Reader{&CommandLine{
+		Prefix: "--",
+		Source: []string{"cmd", "--port", "9090", "-v", "--no-cache", "--timeout", "5s", "--host", "a.com", "--host", "b.com"},
+		Short:  map[string]string{"v": "verbose"},
+		Lists:  []string{"host"},
+	}}}
+	defer mustShutdown(t, conf)
+	assert.Equal(t, int64(9090), conf.Int(ctx, "port", 0).Get())
+	assert.True(t, conf.Bool(ctx, "verbose", false).Get())
+	assert.False(t, conf.Bool(ctx, "cache", true).Get())
+	assert.Equal(t, time.Second*5, conf.Duration(ctx, "timeout", 0).Get())
+	assert.Equal(t, "a.com,b.com", conf.Str(ctx, "host", "").Get())
+}
+
+func TestCommandLine_Check_help(t *testing.T) {
+	ctx := context.Background()
+	var out bytes.Buffer
+	cmd := &CommandLine{
+		Prefix: "--",
+		Source: []string{"cmd", "--port=9090", "--help", "--unknown=1"},
+		Output: &out,
+	}
+	// Readers of the same type are told apart by their index and Prefix
+	other := &CommandLine{Prefix: "-", Source: []string{"cmd", "-retries=3"}}
+	conf := &Distconf{Readers: []Reader{other, cmd}}
+	defer mustShutdown(t, conf)
+	conf.Int(ctx, "port", 8080, WithDescription("Port to listen on"))
+	conf.Int(ctx, "retries", 1)
+	conf.Str(ctx, "host", "", WithAliases("hostname"))
+	conf.Duration(ctx, "timeout", time.Second, Deprecated("deadline"))
+
+	assert.Equal(t, ErrHelp, cmd.Check(conf))
+	assert.Equal(t, "  --host str\n"+
+		"    \t(default \"\", source default, aliases hostname)\n"+
+		"  --port int\n"+
+		"    \tPort to listen on\n"+
+		"    \t(default 8080, source Readers[1] *distconf.CommandLine prefix=--)\n"+
+		"  --retries int\n"+
+		"    \t(default 1, source Readers[0] *distconf.CommandLine prefix=-)\n"+
+		"  --timeout duration\n"+
+		"    \t(default 1s, source default, deprecated: use --deadline)\n", out.String())
+
+	var written bytes.Buffer
+	require.NoError(t, cmd.WriteHelp(&written, conf))
+	assert.Equal(t, out.String(), written.String())
+	assert.Equal(t, errNope, cmd.WriteHelp(&failingWriter{}, conf))
+	cmd.Output = &failingWriter{}
+	assert.Equal(t, errNope, cmd.Check(conf))
+
+	// A registered help key is not asking for help
+	conf.Bool(ctx, "help", false)
+	cmd.Source = []string{"--help"}
+	assert.NoError(t, cmd.Check(conf))
+}
+
+func TestCommandLine_Check_unknown(t *testing.T) {
+	ctx := context.Background()
+	cmd := &CommandLine{
+		Prefix: "--",
+		Source: []string{"cmd", "--port=9090", "--prot=1", "--prot", "2", "--hostname=a", "--verbose", "--no-host", "--no-such", "-x", "--=1", "--", "--after"},
+	}
+	conf := &Distconf{Readers: []Reader{cmd}}
+	defer mustShutdown(t, conf)
+	var reported []string
+	conf.Hooks.OnError = func(msg string, distconfKey string, err error) {
+		reported = append(reported, distconfKey)
+	}
+	conf.Int(ctx, "port", 8080)
+	conf.Str(ctx, "host", "", WithAliases("hostname"))
+
+	err := cmd.Check(conf)
+	require.IsType(t, KeyErrors{}, err)
+	assert.Equal(t, KeyErrors{"prot": errUnknownArgument, "verbose": errUnknownArgument, "no-such": errUnknownArgument}, err)
+	assert.Equal(t, []string{"prot", "verbose", "no-such"}, reported)
+
+	cmd.Source = []string{"--port=1"}
+	assert.NoError(t, cmd.Check(conf))
+
+	// Without a prefix, every argument would be unknown
+	noPrefix := &CommandLine{Source: []string{"cmd", "port=1"}}
+	assert.NoError(t, noPrefix.Check(conf))
+}
+
+func TestDescribeSource(t *testing.T) {
+	env := &CachingReader{Reader: &Environment{Prefix: "APP_"}}
+	m := &Mem{}
+	assert.Equal(t, "Readers[1] *distconf.CachingReader prefix=APP_", describeSource([]Reader{m, env}, env))
+	assert.Equal(t, "Readers[0] *distconf.Mem", describeSource([]Reader{m, env}, m))
+	// A removed Reader has no index
+	assert.Equal(t, "*distconf.Mem", describeSource(nil, m))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"expvar"
 	"math"
+	"reflect"
 	"runtime"
 	"sync"
 	"time"
@@ -16,6 +17,18 @@ type Hooks struct {
 	// cannot be directly returned to the caller.
 	// distconfKey is the key that caused the error.
 	OnError func(msg string, distconfKey string, err error)
+	// OnSnapshotServe is called when a SnapshotCache serves distconfKey from its snapshot because the wrapped
+	// Reader failed.  age is how long ago the served value was read.
+	OnSnapshotServe func(distconfKey string, age time.Duration)
+	// OnCircuitStateChange is called when a circuit breaker created by WithCircuitBreaker changes state.  name is
+	// the Name of its CircuitBreakerConfig.
+	OnCircuitStateChange func(name string, from CircuitState, to CircuitState)
+	// OnDeprecatedKey is called when a Reader supplies a value for distconfKey, which was registered with
+	// Deprecated.  replacementKey is the key to use instead, and may be empty.
+	OnDeprecatedKey func(distconfKey string, replacementKey string)
+	// OnAliasUsed is called when the value of distconfKey, which was registered with WithAliases, came from alias
+	// instead of from distconfKey itself.
+	OnAliasUsed func(distconfKey string, alias string)
 }
 
 func (h Hooks) onError(msg string, distconfKey string, err error) {
@@ -24,8 +37,33 @@ func (h Hooks) onError(msg string, distconfKey string, err error) {
 	}
 }
 
+func (h Hooks) onSnapshotServe(distconfKey string, age time.Duration) {
+	if h.OnSnapshotServe != nil {
+		h.OnSnapshotServe(distconfKey, age)
+	}
+}
+
+func (h Hooks) onDeprecatedKey(distconfKey string, replacementKey string) {
+	if h.OnDeprecatedKey != nil {
+		h.OnDeprecatedKey(distconfKey, replacementKey)
+	}
+}
+
+func (h Hooks) onAliasUsed(distconfKey string, alias string) {
+	if h.OnAliasUsed != nil {
+		h.OnAliasUsed(distconfKey, alias)
+	}
+}
+
+func (h Hooks) onCircuitStateChange(name string, from CircuitState, to CircuitState) {
+	if h.OnCircuitStateChange != nil {
+		h.OnCircuitStateChange(name, from, to)
+	}
+}
+
 // Distconf gets configuration data from the first backing that has it.  It is a race condition to modify Hooks
-// or Readers after you've started using Distconf.  All public functions of Distconf are thread safe.
+// or Readers after you've started using Distconf.  Use AddReader and RemoveReader instead.  All public functions of
+// Distconf are thread safe.
 type Distconf struct {
 	// Hooks are optional callbacks that let you get information about the internal workings and errors of distconf.
 	Hooks Hooks
@@ -33,19 +71,60 @@ type Distconf struct {
 	// order is important as information from a first backend will be returned before the later ones.
 	Readers []Reader
 	// How long to timeout out of band refresh calls triggered by Watch() callbacks.  Defaults to 1 second.
-	RefreshTimeout         time.Duration
+	RefreshTimeout time.Duration
+	// ErrorMode controls what happens to variables when a Reader errors during a refresh.  Defaults to
+	// ErrorFallThrough.  Variables can override it with WithErrorMode.
+	ErrorMode ErrorMode
+	// ErrorGracePeriod is how long ErrorSticky variables keep their value while a Reader errors.  Defaults to
+	// 1 minute.
+	ErrorGracePeriod time.Duration
+	// ErrorRetryInterval is the first backoff between refresh retries of ErrorSticky variables.  It doubles on
+	// each failure, up to a minute.  Defaults to 1 second.
+	ErrorRetryInterval time.Duration
+	// ResyncConcurrency is how many keys RefreshAll and StartResync refresh at once.  Defaults to 4.
+	ResyncConcurrency      int
 	varsMutex              sync.Mutex
 	infoMutex              sync.RWMutex
 	registeredWatchesMutex sync.Mutex
 	registeredVars         map[string]*registeredVariableTracker
 	distInfos              map[string]distInfo
-	registeredWatches      map[string][]Watcher
+	registeredWatches      map[string][]*registeredWatch
 	callerFunc             func(int) (uintptr, string, int, bool)
+	nowFunc                func() time.Time
+	retryMutex             sync.Mutex
+	shutdown               bool
+	preloadMutex           sync.Mutex
+	preloaded              map[string]preloadedKey
+	readersMutex           sync.RWMutex
+	readersGeneration      uint64
+	resyncCancels          []context.CancelFunc
+	resyncs                sync.WaitGroup
+	groupsMutex            sync.Mutex
+	groups                 map[string][]*Group
+}
+
+// registeredWatch is a Watcher watching a key.  unsubscribe removes the watch if the Watcher is a Subscriber.
+type registeredWatch struct {
+	watcher     Watcher
+	unsubscribe func()
+}
+
+// unwatch removes the watch of key, without touching watches other code added to the same Watcher if it is a
+// Subscriber.
+func (w *registeredWatch) unwatch(ctx context.Context, key string) error {
+	if w.unsubscribe != nil {
+		w.unsubscribe()
+		return nil
+	}
+	return w.watcher.Watch(ctx, key, nil)
 }
 
 type registeredVariableTracker struct {
 	distvar        configVariable
 	hasInitialized sync.Once
+	options        varOptions
+	errors         errorState
+	version        versionState
 }
 
 type configVariable interface {
@@ -77,19 +156,47 @@ type distInfo struct {
 	Line         int         `json:"line"`
 	DefaultValue interface{} `json:"default_value"`
 	DistType     distType    `json:"dist_type"`
+	// Version of the applied value, if it came from a VersionedReader
+	Version     int64    `json:"version,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Owner       string   `json:"owner,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Deprecated  bool     `json:"deprecated,omitempty"`
+	// ReplacementKey is the key to use instead of a deprecated key
+	ReplacementKey string `json:"replacement_key,omitempty"`
+	// Aliases are the old keys the variable is also read from
+	Aliases []string `json:"aliases,omitempty"`
 }
 
-func (c *Distconf) grabInfo(key string) {
+// callSite is the file and line that registered a key
+type callSite struct {
+	file string
+	line int
+	ok   bool
+}
+
+// caller returns the call site skip frames above the function that calls caller
+func (c *Distconf) caller(skip int) callSite {
 	if c.callerFunc == nil {
 		c.callerFunc = runtime.Caller
 	}
-	_, file, line, ok := c.callerFunc(2)
-	if !ok {
+	_, file, line, ok := c.callerFunc(skip + 1)
+	return callSite{file: file, line: line, ok: ok}
+}
+
+func (c *Distconf) grabInfo(key string) {
+	site := c.caller(2)
+	if !site.ok {
 		c.Hooks.onError("unable to find call for distconf", key, nil)
 	}
+	c.setCallSite(key, site)
+}
+
+// setCallSite records site as where key was registered
+func (c *Distconf) setCallSite(key string, site callSite) {
 	info := distInfo{
-		File: file,
-		Line: line,
+		File: site.file,
+		Line: site.line,
 	}
 	c.infoMutex.Lock()
 	defer c.infoMutex.Unlock()
@@ -115,7 +222,8 @@ func (c *Distconf) Var() expvar.Var {
 }
 
 // Info returns an expvar variable that shows the information for all configuration variables.
-// Information consist of file, line, default value and type of variable.
+// Information consist of file, line, default value and type of variable, plus the description, owner, tags and
+// deprecation of variables registered with those options.
 func (c *Distconf) Info() expvar.Var {
 	return expvar.Func(func() interface{} {
 		c.infoMutex.RLock()
@@ -123,13 +231,20 @@ func (c *Distconf) Info() expvar.Var {
 
 		m := make(map[string]distInfo, len(c.distInfos))
 		for k, i := range c.distInfos {
-			v, ok := c.registeredVars[k]
+			rv, ok := c.registeredVars[k]
 			if ok {
 				v := distInfo{
-					File:         i.File,
-					Line:         i.Line,
-					DefaultValue: v.distvar.GenericGetDefault(),
-					DistType:     v.distvar.Type(),
+					File:           i.File,
+					Line:           i.Line,
+					DefaultValue:   rv.distvar.GenericGetDefault(),
+					DistType:       rv.distvar.Type(),
+					Version:        rv.version.get(),
+					Description:    rv.options.description,
+					Owner:          rv.options.owner,
+					Tags:           rv.options.tags,
+					Deprecated:     rv.options.deprecated,
+					ReplacementKey: rv.options.replacementKey,
+					Aliases:        rv.options.aliases,
 				}
 				m[k] = v
 			}
@@ -139,7 +254,7 @@ func (c *Distconf) Info() expvar.Var {
 }
 
 // Int object that can be referenced to get integer values from a backing config.
-func (c *Distconf) Int(ctx context.Context, key string, defaultVal int64) *Int {
+func (c *Distconf) Int(ctx context.Context, key string, defaultVal int64, opts ...VarOption) *Int {
 	c.grabInfo(key)
 	s := &intConf{
 		defaultVal: defaultVal,
@@ -148,7 +263,7 @@ func (c *Distconf) Int(ctx context.Context, key string, defaultVal int64) *Int {
 		},
 	}
 	// Note: in race conditions 's' may not be the thing actually returned
-	ret, okCast := c.createOrGet(ctx, key, s).(*intConf)
+	ret, okCast := c.createOrGet(ctx, key, s, opts).(*intConf)
 	if !okCast {
 		c.Hooks.onError("Registering key with multiple types!  FIX ME!!!!", key, nil)
 		return nil
@@ -157,7 +272,7 @@ func (c *Distconf) Int(ctx context.Context, key string, defaultVal int64) *Int {
 }
 
 // Float object that can be referenced to get float values from a backing config
-func (c *Distconf) Float(ctx context.Context, key string, defaultVal float64) *Float {
+func (c *Distconf) Float(ctx context.Context, key string, defaultVal float64, opts ...VarOption) *Float {
 	c.grabInfo(key)
 	s := &floatConf{
 		defaultVal: defaultVal,
@@ -166,7 +281,7 @@ func (c *Distconf) Float(ctx context.Context, key string, defaultVal float64) *F
 		},
 	}
 	// Note: in race conditions 's' may not be the thing actually returned
-	ret, okCast := c.createOrGet(ctx, key, s).(*floatConf)
+	ret, okCast := c.createOrGet(ctx, key, s, opts).(*floatConf)
 	if !okCast {
 		c.Hooks.onError("Registering key with multiple types!  FIX ME!!!!", key, nil)
 		return nil
@@ -175,14 +290,14 @@ func (c *Distconf) Float(ctx context.Context, key string, defaultVal float64) *F
 }
 
 // Str object that can be referenced to get string values from a backing config
-func (c *Distconf) Str(ctx context.Context, key string, defaultVal string) *Str {
+func (c *Distconf) Str(ctx context.Context, key string, defaultVal string, opts ...VarOption) *Str {
 	c.grabInfo(key)
 	s := &strConf{
 		defaultVal: defaultVal,
 	}
 	s.currentVal.Store(defaultVal)
 	// Note: in race conditions 's' may not be the thing actually returned
-	ret, okCast := c.createOrGet(ctx, key, s).(*strConf)
+	ret, okCast := c.createOrGet(ctx, key, s, opts).(*strConf)
 	if !okCast {
 		c.Hooks.onError("Registering key with multiple types!  FIX ME!!!!", key, nil)
 		return nil
@@ -191,7 +306,7 @@ func (c *Distconf) Str(ctx context.Context, key string, defaultVal string) *Str
 }
 
 // Bool object that can be referenced to get boolean values from a backing config
-func (c *Distconf) Bool(ctx context.Context, key string, defaultVal bool) *Bool {
+func (c *Distconf) Bool(ctx context.Context, key string, defaultVal bool, opts ...VarOption) *Bool {
 	c.grabInfo(key)
 	var defautlAsInt int32
 	if defaultVal {
@@ -207,7 +322,7 @@ func (c *Distconf) Bool(ctx context.Context, key string, defaultVal bool) *Bool
 		},
 	}
 	// Note: in race conditions 's' may not be the thing actually returned
-	ret, okCast := c.createOrGet(ctx, key, s).(*boolConf)
+	ret, okCast := c.createOrGet(ctx, key, s, opts).(*boolConf)
 	if !okCast {
 		c.Hooks.onError("Registering key with multiple types!  FIX ME!!!!", key, nil)
 		return nil
@@ -216,7 +331,7 @@ func (c *Distconf) Bool(ctx context.Context, key string, defaultVal bool) *Bool
 }
 
 // Duration returns a duration object that calls ParseDuration() on the given key
-func (c *Distconf) Duration(ctx context.Context, key string, defaultVal time.Duration) *Duration {
+func (c *Distconf) Duration(ctx context.Context, key string, defaultVal time.Duration, opts ...VarOption) *Duration {
 	c.grabInfo(key)
 	s := &durationConf{
 		defaultVal: defaultVal,
@@ -227,7 +342,7 @@ func (c *Distconf) Duration(ctx context.Context, key string, defaultVal time.Dur
 		originalKey: key,
 	}
 	// Note: in race conditions 's' may not be the thing actually returned
-	ret, okCast := c.createOrGet(ctx, key, s).(*durationConf)
+	ret, okCast := c.createOrGet(ctx, key, s, opts).(*durationConf)
 	if !okCast {
 		c.Hooks.onError("Registering key with multiple types!  FIX ME!!!!", key, nil)
 		return nil
@@ -239,10 +354,13 @@ func (c *Distconf) Duration(ctx context.Context, key string, defaultVal time.Dur
 // Returns the error of the first reader to return an error.  While Watch itself doesn't take a context, shutdown
 // will stop calling future watches if context ends.
 func (c *Distconf) Shutdown(ctx context.Context) error {
+	c.stopResyncs()
+	c.clearPreloaded()
 	c.varsMutex.Lock()
 	c.registeredWatchesMutex.Lock()
 	defer c.varsMutex.Unlock()
 	defer c.registeredWatchesMutex.Unlock()
+	c.stopRetries()
 	var ret error
 	for key, watches := range c.registeredWatches {
 		for _, watch := range watches {
@@ -251,7 +369,7 @@ func (c *Distconf) Shutdown(ctx context.Context) error {
 				return ctx.Err()
 			default:
 			}
-			if err := watch.Watch(ctx, key, nil); err != nil {
+			if err := watch.unwatch(ctx, key); err != nil {
 				c.Hooks.onError("error unregistering watch", key, err)
 				ret = err
 			}
@@ -272,59 +390,160 @@ func (c *Distconf) watchCallback(key string) func() {
 	}
 }
 
-func (c *Distconf) registerWatches(ctx context.Context, key string, watches []Watcher) {
+// registerWatches watches key on every Watcher, refreshing refreshKey when it changes.  key is an alias of
+// refreshKey, or refreshKey itself.  Nothing is watched if Readers changed since generation, because watches may
+// hold a removed Reader and the refresh that follows the change watches the current ones.
+func (c *Distconf) registerWatches(ctx context.Context, key, refreshKey string, watches []Watcher, generation uint64) {
 	c.registeredWatchesMutex.Lock()
+	if _, current := c.currentReaders(); current != generation {
+		c.registeredWatchesMutex.Unlock()
+		return
+	}
 	if c.registeredWatches == nil {
-		c.registeredWatches = make(map[string][]Watcher)
+		c.registeredWatches = make(map[string][]*registeredWatch)
+	}
+	// Only watch each Watcher once per key, so Watchers that keep many callbacks per key don't get duplicates
+	var newWatches []*registeredWatch
+	for _, w := range watches {
+		if !containsWatcher(c.registeredWatches[key], w) {
+			watch := &registeredWatch{watcher: w}
+			c.registeredWatches[key] = append(c.registeredWatches[key], watch)
+			newWatches = append(newWatches, watch)
+		}
 	}
-	c.registeredWatches[key] = append(c.registeredWatches[key], watches...)
 	// Unlock early so we don't get in deadlock if backing.Watch() somehow executes code that gets back here
 	c.registeredWatchesMutex.Unlock()
-	for _, backing := range watches {
-		err := backing.Watch(ctx, key, c.watchCallback(key))
+	for _, watch := range newWatches {
+		if subscriber, ok := watch.watcher.(Subscriber); ok && canSubscribe(watch.watcher) {
+			unsubscribe := subscriber.Subscribe(key, c.watchCallback(refreshKey))
+			c.registeredWatchesMutex.Lock()
+			watch.unsubscribe = unsubscribe
+			c.registeredWatchesMutex.Unlock()
+			continue
+		}
+		err := watch.watcher.Watch(ctx, key, c.watchCallback(refreshKey))
 		if err != nil {
 			c.Hooks.onError("Unable to watch for config var", key, err)
+			c.forgetWatch(key, watch)
+		}
+	}
+}
+
+// forgetWatch removes watch from the registered watches of key, so the next refresh tries to watch it again
+func (c *Distconf) forgetWatch(key string, watch *registeredWatch) {
+	c.registeredWatchesMutex.Lock()
+	defer c.registeredWatchesMutex.Unlock()
+	watches := c.registeredWatches[key]
+	for i, existing := range watches {
+		if existing == watch {
+			c.registeredWatches[key] = append(watches[:i:i], watches[i+1:]...)
+			return
+		}
+	}
+}
+
+func containsWatcher(watches []*registeredWatch, w Watcher) bool {
+	for _, existing := range watches {
+		if sameInstance(existing.watcher, w) {
+			return true
 		}
 	}
+	return false
+}
+
+// sameInstance is a == b, but false instead of a panic if they are not comparable
+func sameInstance(a interface{}, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) || !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	return a == b
 }
 
-func (c *Distconf) refresh(ctx context.Context, key string, configVar configVariable) {
+// refresh reads key from the Readers in order, checking the aliases of key in each Reader after key itself.
+// preloaded results are used instead of calling Read when they exist and were read from the current Readers.  The
+// first error of a Reader or of invalid bytes is returned, after being reported to Hooks.
+func (c *Distconf) refresh(ctx context.Context, key string, rv *registeredVariableTracker, preloaded preloadedKey) (ret error) {
 	var dynamicReadersOnPath []Watcher
+	hadError := false
+	readers, generation := c.currentReaders()
 	defer func() {
-		c.registerWatches(ctx, key, dynamicReadersOnPath)
+		c.registerWatches(ctx, key, key, dynamicReadersOnPath, generation)
+		for _, alias := range rv.options.aliases {
+			c.registerWatches(ctx, alias, key, dynamicReadersOnPath, generation)
+		}
+		c.refreshDone(key, rv, hadError)
 	}()
-	for _, backing := range c.Readers {
+	if preloaded.generation != generation {
+		preloaded.results = nil
+	}
+	for i, backing := range readers {
 		if asW, ok := backing.(Watcher); ok {
 			dynamicReadersOnPath = append(dynamicReadersOnPath, asW)
 		}
 
-		v, e := backing.Read(ctx, key)
+		var v []byte
+		var version int64
+		var e error
+		if i < len(preloaded.results) {
+			v, version, e = preloaded.results[i].value, preloaded.results[i].version, preloaded.results[i].err
+		} else {
+			v, version, e = readVersioned(ctx, backing, key)
+		}
+		source := key
+		for _, alias := range rv.options.aliases {
+			if e != nil || v != nil {
+				break
+			}
+			source = alias
+			v, version, e = readVersioned(ctx, backing, alias)
+		}
 		if e != nil {
 			c.Hooks.onError("Unable to read from backing", key, e)
+			hadError = true
+			if ret == nil {
+				ret = e
+			}
+			if c.holdOnError(rv) {
+				return ret
+			}
 			continue
 		}
 		if v != nil {
-			e = configVar.Update(v)
+			if rv.options.deprecated {
+				c.Hooks.onDeprecatedKey(key, rv.options.replacementKey)
+			}
+			if source != key {
+				c.Hooks.onAliasUsed(key, source)
+			}
+			e = c.update(rv, backing, source, v, version)
 			if e != nil {
 				c.Hooks.onError("Invalid config bytes", key, e)
+				if ret == nil {
+					ret = e
+				}
 			}
-			return
+			return ret
 		}
 	}
 
 	// None of the readers have this value.  Update it to nil (default).
-	e := configVar.Update(nil)
+	e := c.update(rv, nil, key, nil, 0)
 	if e != nil {
 		c.Hooks.onError("Unable to set bytes to nil/clear", key, e)
 	}
+	return ret
 }
 
-func (c *Distconf) createOrGet(ctx context.Context, key string, defaultVar configVariable) configVariable {
+func (c *Distconf) createOrGet(ctx context.Context, key string, defaultVar configVariable, opts []VarOption) configVariable {
 	c.varsMutex.Lock()
 	rv, exists := c.registeredVars[key]
 	if !exists {
 		rv = &registeredVariableTracker{
 			distvar: defaultVar,
+			options: newVarOptions(opts),
 		}
 		if c.registeredVars == nil {
 			c.registeredVars = make(map[string]*registeredVariableTracker)
@@ -334,7 +553,8 @@ func (c *Distconf) createOrGet(ctx context.Context, key string, defaultVar confi
 	c.varsMutex.Unlock()
 
 	rv.hasInitialized.Do(func() {
-		c.refresh(ctx, key, rv.distvar)
+		// Errors are reported to Hooks
+		_ = c.refresh(ctx, key, rv, c.takePreloaded(key))
 	})
 	return rv.distvar
 }
@@ -350,7 +570,15 @@ func (c *Distconf) Refresh(ctx context.Context, key string) {
 		c.Hooks.onError("Backing callback on variable that doesn't exist", key, nil)
 		return
 	}
-	c.refresh(ctx, key, m.distvar)
+	// Keys of a group are refreshed together, so the group only sees the change once every key has it
+	if groups := c.groupsOf(key); len(groups) > 0 {
+		for _, g := range groups {
+			c.refreshGroup(ctx, g)
+		}
+		return
+	}
+	// Errors are reported to Hooks
+	_ = c.refresh(ctx, key, m, preloadedKey{})
 }
 
 // Reader can get a []byte value for a config key
@@ -362,6 +590,66 @@ type Reader interface {
 	Read(ctx context.Context, key string) ([]byte, error)
 }
 
+// BatchReader is an optional interface of Reader that can read many keys in a single round trip.  It is used by
+// Distconf.Preload.
+type BatchReader interface {
+	// ReadMany should lookup keys inside the configuration source.  Keys that are not inside this reader should
+	// be missing from the returned map.  An error will skip this source for every key.
+	ReadMany(ctx context.Context, keys []string) (map[string][]byte, error)
+}
+
+// Lister is an optional interface of Reader that can enumerate the keys it has.  It is used by
+// Distconf.Unregistered and Distconf.Unused.
+type Lister interface {
+	// List should return every key inside the configuration source that starts with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// VersionedReader is an optional interface of Reader that knows the version of each value, like a ZooKeeper
+// mzxid, an etcd revision or a Consul ModifyIndex.  Distconf uses it instead of Read, and ignores values that are
+// not newer than the value it already applied from the same reader.
+type VersionedReader interface {
+	// ReadVersioned should lookup a key like Read, and also return the version of the value.  Versions must
+	// increase every time the key changes.  A version of 0 means the version is unknown.
+	ReadVersioned(ctx context.Context, key string) ([]byte, int64, error)
+}
+
+// Subscriber is an optional interface of Watcher that keeps many callbacks per key and can remove each of them on
+// its own.  Distconf uses it instead of Watch, so Distconfs that share a Reader don't remove each other's watches
+// when one of them shuts down.
+type Subscriber interface {
+	// Subscribe should execute callback every time the value of key changes, until unsubscribe is called.
+	Subscribe(key string, callback func()) (unsubscribe func())
+}
+
+// canSubscribe returns true if w is a Subscriber that is not just a wrapper of a Watcher without Subscribe
+func canSubscribe(w Watcher) bool {
+	var r interface{} = w
+	for {
+		inner, ok := r.(wrapper)
+		if !ok {
+			_, ok = r.(Subscriber)
+			return ok
+		}
+		r = inner.wrapped()
+	}
+}
+
+// subscribe calls Subscribe of r if it is a Subscriber.  Otherwise it falls back to Watch, and unsubscribe removes
+// every callback of key.  Errors of Watch are ignored, so use canSubscribe before relying on it.
+func subscribe(r Reader, key string, callback func()) (unsubscribe func()) {
+	if s, ok := r.(Subscriber); ok {
+		return s.Subscribe(key, callback)
+	}
+	w, ok := r.(Watcher)
+	if !ok || w.Watch(context.Background(), key, callback) != nil {
+		return func() {}
+	}
+	return func() {
+		_ = w.Watch(context.Background(), key, nil)
+	}
+}
+
 // Shutdownable is an optional interface of Reader that allows it to be gracefully shutdown.
 type Shutdownable interface {
 	// Shutdown should signal to a reader it is no longer needed by Distconf. It should expect
@@ -3,17 +3,40 @@ package distconf
 import (
 	"context"
 	"os"
+	"sort"
+	"strings"
 )
 
 type Environment struct {
+	// Prefix is added to every key before it is looked up, so Prefix "APP_" reads key "port" from APP_port
+	Prefix string
 }
 
 var _ Reader = &CommandLine{}
+var _ Lister = &Environment{}
 
 func (p *Environment) Read(_ context.Context, key string) ([]byte, error) {
-	val := os.Getenv(key)
+	val := os.Getenv(p.Prefix + key)
 	if val == "" {
 		return nil, nil
 	}
 	return []byte(val), nil
 }
+
+// List returns every non empty environment variable that starts with Prefix and prefix, without Prefix.  Without a
+// Prefix it returns nothing, because variables like PATH and HOME are not config keys.
+func (p *Environment) List(_ context.Context, prefix string) ([]string, error) {
+	if p.Prefix == "" {
+		return nil, nil
+	}
+	var ret []string
+	for _, kv := range os.Environ() {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[1] == "" || !strings.HasPrefix(parts[0], p.Prefix+prefix) {
+			continue
+		}
+		ret = append(ret, parts[0][len(p.Prefix):])
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
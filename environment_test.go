@@ -19,3 +19,26 @@ func TestEnvironment_Read(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, []byte("abc"), b)
 }
+
+func TestEnvironment_prefix(t *testing.T) {
+	ctx := context.Background()
+	e := &Environment{Prefix: "TestEnvironment_prefix_"}
+	assert.NoError(t, os.Setenv("TestEnvironment_prefix_port", "80"))
+	assert.NoError(t, os.Setenv("TestEnvironment_prefix_host", "a.com"))
+	assert.NoError(t, os.Setenv("TestEnvironment_prefix_empty", ""))
+	b, err := e.Read(ctx, "port")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("80"), b)
+
+	keys, err := e.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"host", "port"}, keys)
+	keys, err = e.List(ctx, "p")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"port"}, keys)
+
+	// Without a Prefix every variable would be an unused key
+	keys, err = (&Environment{}).List(ctx, "")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
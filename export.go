@@ -0,0 +1,169 @@
+package distconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// keyDescription is everything known about a registered key, used to document it
+type keyDescription struct {
+	key          string
+	distType     distType
+	defaultValue interface{}
+	options      varOptions
+	// source is the Reader of the current value, or nil if the value is the default
+	source Reader
+}
+
+var distTypeNames = map[distType]string{
+	strType:      "str",
+	boolType:     "bool",
+	floatType:    "float",
+	durationType: "duration",
+	intType:      "int",
+}
+
+// describeKeys returns every registered key, sorted
+func (c *Distconf) describeKeys() []keyDescription {
+	c.varsMutex.Lock()
+	ret := make([]keyDescription, 0, len(c.registeredVars))
+	for key, rv := range c.registeredVars {
+		d := keyDescription{
+			key:          key,
+			distType:     rv.distvar.Type(),
+			defaultValue: rv.distvar.GenericGetDefault(),
+			options:      rv.options,
+			source:       rv.version.source(),
+		}
+		// Bool stores its default as an int32
+		if d.distType == boolType {
+			d.defaultValue = d.defaultValue != int32(0)
+		}
+		ret = append(ret, d)
+	}
+	c.varsMutex.Unlock()
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].key < ret[j].key
+	})
+	return ret
+}
+
+// durationPattern matches the strings time.ParseDuration accepts
+const durationPattern = `^[-+]?(0|(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|μs|ms|s|m|h))+)$`
+
+// ExportSchema returns a JSON Schema document of every registered variable, as an object with one property per
+// key.  Each property has the JSON type and default of the variable, the bounds of WithMin, WithMax and WithOneOf,
+// its description and deprecation, and its owner, tags, aliases and replacement key as x- extensions.  Durations are
+// strings that must match the format of time.ParseDuration.  Every variable has a default, so required is empty.  The
+// output is sorted, so it can be diffed between releases.
+func (c *Distconf) ExportSchema() ([]byte, error) {
+	properties := make(map[string]interface{})
+	for _, d := range c.describeKeys() {
+		property := map[string]interface{}{
+			"default": d.defaultValue,
+		}
+		switch d.distType {
+		case intType:
+			property["type"] = "integer"
+		case floatType:
+			property["type"] = "number"
+		case boolType:
+			property["type"] = "boolean"
+		case strType:
+			property["type"] = "string"
+		case durationType:
+			property["type"] = "string"
+			property["pattern"] = durationPattern
+		}
+		if d.options.min != nil {
+			property["minimum"] = *d.options.min
+		}
+		if d.options.max != nil {
+			property["maximum"] = *d.options.max
+		}
+		if len(d.options.oneOf) != 0 {
+			property["enum"] = d.options.oneOf
+		}
+		if d.options.description != "" {
+			property["description"] = d.options.description
+		}
+		if d.options.deprecated {
+			property["deprecated"] = true
+		}
+		if d.options.replacementKey != "" {
+			property["x-replacement-key"] = d.options.replacementKey
+		}
+		if d.options.owner != "" {
+			property["x-owner"] = d.options.owner
+		}
+		if len(d.options.tags) != 0 {
+			property["x-tags"] = d.options.tags
+		}
+		if len(d.options.aliases) != 0 {
+			property["x-aliases"] = d.options.aliases
+		}
+		properties[d.key] = property
+	}
+	return json.MarshalIndent(map[string]interface{}{
+		"$schema":    "https://json-schema.org/draft/2019-09/schema",
+		"type":       "object",
+		"properties": properties,
+		"required":   []string{},
+	}, "", "  ")
+}
+
+// ExportMarkdown writes a markdown table of every registered variable, sorted by key, with its type, default,
+// description, owner, tags, bounds, aliases and deprecation.  File and line are left out so moving code does not
+// change the output.
+func (c *Distconf) ExportMarkdown(w io.Writer) error {
+	if _, err := io.WriteString(w, "| Key | Type | Default | Description | Owner | Tags | Notes |\n|---|---|---|---|---|---|---|\n"); err != nil {
+		return err
+	}
+	for _, d := range c.describeKeys() {
+		var notes []string
+		if d.options.deprecated {
+			if d.options.replacementKey != "" {
+				notes = append(notes, fmt.Sprintf("Deprecated: use `%s`", d.options.replacementKey))
+			} else {
+				notes = append(notes, "Deprecated")
+			}
+		}
+		if d.options.min != nil {
+			notes = append(notes, fmt.Sprintf("Min: %v", *d.options.min))
+		}
+		if d.options.max != nil {
+			notes = append(notes, fmt.Sprintf("Max: %v", *d.options.max))
+		}
+		if len(d.options.oneOf) != 0 {
+			notes = append(notes, "One of: `"+strings.Join(d.options.oneOf, "`, `")+"`")
+		}
+		if len(d.options.aliases) != 0 {
+			notes = append(notes, "Aliases: `"+strings.Join(d.options.aliases, "`, `")+"`")
+		}
+		var defaultCell string
+		if defaultValue := fmt.Sprint(d.defaultValue); defaultValue != "" {
+			defaultCell = "`" + markdownCell(defaultValue) + "`"
+		}
+		_, err := fmt.Fprintf(w, "| `%s` | %s | %s | %s | %s | %s | %s |\n",
+			markdownCell(d.key),
+			distTypeNames[d.distType],
+			defaultCell,
+			markdownCell(d.options.description),
+			markdownCell(d.options.owner),
+			markdownCell(strings.Join(d.options.tags, ", ")),
+			markdownCell(strings.Join(notes, "; ")),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markdownCell escapes s so it stays inside a single table cell
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
@@ -0,0 +1,114 @@
+package distconf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func exportConf(ctx context.Context) *Distconf {
+	conf := &Distconf{}
+	conf.Int(ctx, "port", 8080, WithDescription("Port to | listen on"), WithOwner("infra"), WithTags("network", "startup"))
+	conf.Float(ctx, "ratio", 0.5, WithMin(0), WithMax(1))
+	conf.Str(ctx, "host", "", WithAliases("old.host", "hostname"))
+	conf.Str(ctx, "mode", "fast", WithOneOf("fast", "slow"))
+	conf.Bool(ctx, "debug", true, Deprecated("log.level"))
+	conf.Duration(ctx, "timeout", time.Second*90, Deprecated(""))
+	return conf
+}
+
+func TestDistconf_ExportSchema(t *testing.T) {
+	ctx := context.Background()
+	conf := exportConf(ctx)
+	defer mustShutdown(t, conf)
+	b, err := conf.ExportSchema()
+	require.NoError(t, err)
+	var schema struct {
+		Schema     string                            `json:"$schema"`
+		Type       string                            `json:"type"`
+		Required   []string                          `json:"required"`
+		Properties map[string]map[string]interface{} `json:"properties"`
+	}
+	require.NoError(t, json.Unmarshal(b, &schema))
+	assert.Equal(t, "https://json-schema.org/draft/2019-09/schema", schema.Schema)
+	assert.Equal(t, "object", schema.Type)
+	assert.NotNil(t, schema.Required)
+	assert.Empty(t, schema.Required)
+	assert.Equal(t, map[string]interface{}{
+		"type":        "integer",
+		"default":     float64(8080),
+		"description": "Port to | listen on",
+		"x-owner":     "infra",
+		"x-tags":      []interface{}{"network", "startup"},
+	}, schema.Properties["port"])
+	assert.Equal(t, map[string]interface{}{
+		"type":    "number",
+		"default": 0.5,
+		"minimum": float64(0),
+		"maximum": float64(1),
+	}, schema.Properties["ratio"])
+	assert.Equal(t, map[string]interface{}{
+		"type":    "string",
+		"default": "fast",
+		"enum":    []interface{}{"fast", "slow"},
+	}, schema.Properties["mode"])
+	assert.Equal(t, map[string]interface{}{
+		"type":      "string",
+		"default":   "",
+		"x-aliases": []interface{}{"old.host", "hostname"},
+	}, schema.Properties["host"])
+	assert.Equal(t, map[string]interface{}{
+		"type":              "boolean",
+		"default":           true,
+		"deprecated":        true,
+		"x-replacement-key": "log.level",
+	}, schema.Properties["debug"])
+	assert.Equal(t, "string", schema.Properties["timeout"]["type"])
+	assert.Equal(t, "1m30s", schema.Properties["timeout"]["default"])
+
+	pattern := regexp.MustCompile(schema.Properties["timeout"]["pattern"].(string))
+	for _, valid := range []string{"0", "1m30s", "-1.5h", "300ms", "2h45m", ".5s", "1µs"} {
+		_, err := time.ParseDuration(valid)
+		require.NoError(t, err)
+		assert.True(t, pattern.MatchString(valid), valid)
+	}
+	for _, invalid := range []string{"", "1", "1d", "s", "1m30"} {
+		assert.False(t, pattern.MatchString(invalid), invalid)
+	}
+
+	// The output is stable, so it can be diffed
+	again, err := conf.ExportSchema()
+	require.NoError(t, err)
+	assert.Equal(t, string(b), string(again))
+}
+
+func TestDistconf_ExportMarkdown(t *testing.T) {
+	ctx := context.Background()
+	conf := exportConf(ctx)
+	defer mustShutdown(t, conf)
+	var buf bytes.Buffer
+	require.NoError(t, conf.ExportMarkdown(&buf))
+	assert.Equal(t, "| Key | Type | Default | Description | Owner | Tags | Notes |\n"+
+		"|---|---|---|---|---|---|---|\n"+
+		"| `debug` | bool | `true` |  |  |  | Deprecated: use `log.level` |\n"+
+		"| `host` | str |  |  |  |  | Aliases: `old.host`, `hostname` |\n"+
+		"| `mode` | str | `fast` |  |  |  | One of: `fast`, `slow` |\n"+
+		"| `port` | int | `8080` | Port to \\| listen on | infra | network, startup |  |\n"+
+		"| `ratio` | float | `0.5` |  |  |  | Min: 0; Max: 1 |\n"+
+		"| `timeout` | duration | `1m30s` |  |  |  | Deprecated |\n", buf.String())
+
+	assert.Equal(t, errNope, conf.ExportMarkdown(&failingWriter{}))
+}
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	return 0, errNope
+}
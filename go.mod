@@ -4,5 +4,6 @@ go 1.12
 
 require (
 	github.com/golangci/golangci-lint v1.18.0
-	github.com/stretchr/testify v1.2.2
+	github.com/stretchr/testify v1.6.1
+	gopkg.in/yaml.v2 v2.2.2
 )
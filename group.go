@@ -0,0 +1,179 @@
+package distconf
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// GroupWatch is executed if registered on a Group any time the values of the group change
+type GroupWatch func(group *Group, oldValue *Snapshot)
+
+// Group is a consistent view of several config variables.  When any key of the group changes, every key is
+// refreshed before a new Snapshot is swapped in, so a Snapshot never mixes a new host with an old port that were
+// written together.
+type Group struct {
+	keys []string
+	vars map[string]*registeredVariableTracker
+
+	// Lock on watches so updates are atomic
+	mutex      sync.Mutex
+	watches    []GroupWatch
+	currentVal atomic.Value
+}
+
+// Snapshot is an immutable set of config values, taken from a Group
+type Snapshot struct {
+	values map[string]interface{}
+}
+
+// Group returns a Group of keys.  Every key must already be registered with Int, Str, etc.
+func (c *Distconf) Group(keys ...string) (*Group, error) {
+	g := &Group{
+		keys: keys,
+		vars: make(map[string]*registeredVariableTracker, len(keys)),
+	}
+	c.varsMutex.Lock()
+	for _, key := range keys {
+		rv, exists := c.registeredVars[key]
+		if !exists {
+			c.varsMutex.Unlock()
+			return nil, fmt.Errorf("group key %s is not registered", key)
+		}
+		g.vars[key] = rv
+	}
+	c.varsMutex.Unlock()
+
+	g.currentVal.Store(g.snapshot())
+	c.groupsMutex.Lock()
+	if c.groups == nil {
+		c.groups = make(map[string][]*Group)
+	}
+	for _, key := range keys {
+		c.groups[key] = append(c.groups[key], g)
+	}
+	c.groupsMutex.Unlock()
+	// Catch changes that happened before the group was tracked
+	g.update()
+	return g, nil
+}
+
+// groupsOf returns every Group that contains key
+func (c *Distconf) groupsOf(key string) []*Group {
+	c.groupsMutex.Lock()
+	defer c.groupsMutex.Unlock()
+	ret := make([]*Group, len(c.groups[key]))
+	copy(ret, c.groups[key])
+	return ret
+}
+
+// allGroups returns every Group once
+func (c *Distconf) allGroups() []*Group {
+	c.groupsMutex.Lock()
+	defer c.groupsMutex.Unlock()
+	seen := make(map[*Group]struct{})
+	var ret []*Group
+	for _, groups := range c.groups {
+		for _, g := range groups {
+			if _, exists := seen[g]; !exists {
+				seen[g] = struct{}{}
+				ret = append(ret, g)
+			}
+		}
+	}
+	return ret
+}
+
+// refreshGroup refreshes every key of g, then swaps in the new Snapshot
+func (c *Distconf) refreshGroup(ctx context.Context, g *Group) {
+	for _, key := range g.keys {
+		// Errors are reported to Hooks
+		_ = c.refresh(ctx, key, g.vars[key], preloadedKey{})
+	}
+	g.update()
+}
+
+// snapshot of the current value of every key
+func (g *Group) snapshot() *Snapshot {
+	values := make(map[string]interface{}, len(g.vars))
+	for key, rv := range g.vars {
+		values[key] = rv.distvar.GenericGet()
+	}
+	return &Snapshot{values: values}
+}
+
+// update swaps in a new Snapshot and executes watches if any value changed
+func (g *Group) update() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	oldValue := g.Get()
+	newValue := g.snapshot()
+	if oldValue.equal(newValue) {
+		return
+	}
+	g.currentVal.Store(newValue)
+	for _, w := range g.watches {
+		w(g, oldValue)
+	}
+}
+
+// Get the current Snapshot of the group
+func (g *Group) Get() *Snapshot {
+	return g.currentVal.Load().(*Snapshot)
+}
+
+// Watch adds a watch for changes to the group.  It is executed once per change, even if many keys changed.
+func (g *Group) Watch(watch GroupWatch) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.watches = append(g.watches, watch)
+}
+
+func (s *Snapshot) equal(other *Snapshot) bool {
+	if len(s.values) != len(other.values) {
+		return false
+	}
+	for key, value := range s.values {
+		if otherValue, exists := other.values[key]; !exists || otherValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Get the value of key, or nil if key is not in the group
+func (s *Snapshot) Get(key string) interface{} {
+	return s.values[key]
+}
+
+// Int value of key, or 0 if key is not an Int of the group
+func (s *Snapshot) Int(key string) int64 {
+	ret, _ := s.values[key].(int64)
+	return ret
+}
+
+// Float value of key, or 0 if key is not a Float of the group
+func (s *Snapshot) Float(key string) float64 {
+	ret, _ := s.values[key].(float64)
+	return ret
+}
+
+// Str value of key, or "" if key is not a Str of the group
+func (s *Snapshot) Str(key string) string {
+	ret, _ := s.values[key].(string)
+	return ret
+}
+
+// Bool value of key, or false if key is not a Bool of the group
+func (s *Snapshot) Bool(key string) bool {
+	ret, _ := s.values[key].(bool)
+	return ret
+}
+
+// Duration value of key, or 0 if key is not a Duration of the group
+func (s *Snapshot) Duration(key string) time.Duration {
+	ret, _ := s.values[key].(time.Duration)
+	return ret
+}
@@ -0,0 +1,58 @@
+package distconf
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDistconf_Group(t *testing.T) {
+	ctx := context.Background()
+	m := &Mem{}
+	require.NoError(t, m.WriteMany(ctx, map[string][]byte{"host": []byte("a.com"), "port": []byte("80")}))
+	conf := &Distconf{Readers: []Reader{m}}
+	defer mustShutdown(t, conf)
+	conf.Str(ctx, "host", "")
+	conf.Int(ctx, "port", 0)
+	conf.Bool(ctx, "tls", false)
+	conf.Float(ctx, "ratio", 0.5)
+	conf.Duration(ctx, "timeout", time.Second)
+
+	g, err := conf.Group("host", "port", "tls", "ratio", "timeout")
+	require.NoError(t, err)
+	snap := g.Get()
+	assert.Equal(t, "a.com", snap.Str("host"))
+	assert.Equal(t, int64(80), snap.Int("port"))
+	assert.False(t, snap.Bool("tls"))
+	assert.Equal(t, 0.5, snap.Float("ratio"))
+	assert.Equal(t, time.Second, snap.Duration("timeout"))
+	assert.Nil(t, snap.Get("missing"))
+	assert.Equal(t, int64(0), snap.Int("host"))
+
+	var seen []*Snapshot
+	g.Watch(func(group *Group, oldValue *Snapshot) {
+		assert.Equal(t, g, group)
+		seen = append(seen, group.Get())
+	})
+	require.NoError(t, m.WriteMany(ctx, map[string][]byte{"host": []byte("b.com"), "port": []byte("8080"), "tls": []byte("true")}))
+	// A single change for all three keys, with every key updated
+	require.Len(t, seen, 1)
+	assert.Equal(t, "b.com", seen[0].Str("host"))
+	assert.Equal(t, int64(8080), seen[0].Int("port"))
+	assert.True(t, seen[0].Bool("tls"))
+	// Old snapshots are immutable
+	assert.Equal(t, "a.com", snap.Str("host"))
+
+	require.NoError(t, m.Write(ctx, "ratio", []byte("0.5")))
+	assert.Len(t, seen, 1)
+	require.NoError(t, m.Write(ctx, "timeout", []byte("2s")))
+	assert.Len(t, seen, 2)
+	require.NoError(t, conf.RefreshAll(ctx))
+	assert.Len(t, seen, 2)
+
+	_, err = conf.Group("host", "unknown")
+	assert.Error(t, err)
+}
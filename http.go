@@ -0,0 +1,330 @@
+package distconf
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTPReader reads config from a JSON document served over HTTP.  The document is flattened into keys by joining
+// nested object names with Separator.  Strings are returned as is and other values as their JSON encoding.  Nulls
+// are missing keys.  The document is polled with If-None-Match, so an unchanged document costs a 304, and the last
+// good document is kept if the endpoint is down.  All public functions are thread safe.
+type HTTPReader struct {
+	// URL of the JSON document
+	URL string
+	// Header is added to every request.  Use it for auth.
+	Header http.Header
+	// Client is used for all requests.  Defaults to a client that uses TLSConfig
+	Client *http.Client
+	// TLSConfig is used if Client is nil
+	TLSConfig *tls.Config
+	// Separator joins the names of nested objects.  Defaults to "."
+	Separator string
+	// PollInterval is the minimum time between fetches.  A longer Cache-Control max-age is respected.  Defaults
+	// to 30 seconds
+	PollInterval time.Duration
+	// Hooks report errors that happen in the background
+	Hooks Hooks
+
+	startOnce  sync.Once
+	onClose    chan struct{}
+	wg         sync.WaitGroup
+	clientOnce sync.Once
+	client     *http.Client
+
+	// fetchMutex makes sure only one fetch happens at a time
+	fetchMutex sync.Mutex
+	mu         sync.RWMutex
+	fetched    bool
+	values     map[string][]byte
+	etag       string
+	maxAge     time.Duration
+	watches    map[string]func()
+}
+
+var _ Reader = &HTTPReader{}
+var _ Watcher = &HTTPReader{}
+var _ Shutdownable = &HTTPReader{}
+var _ BatchReader = &HTTPReader{}
+
+func (h *HTTPReader) httpClient() *http.Client {
+	h.clientOnce.Do(func() {
+		h.client = h.Client
+		if h.client == nil {
+			h.client = &http.Client{
+				Transport: &http.Transport{
+					Proxy:           http.ProxyFromEnvironment,
+					TLSClientConfig: h.TLSConfig,
+				},
+			}
+		}
+	})
+	return h.client
+}
+
+func (h *HTTPReader) pollInterval() time.Duration {
+	interval := h.PollInterval
+	if interval == 0 {
+		interval = time.Second * 30
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.maxAge > interval {
+		return h.maxAge
+	}
+	return interval
+}
+
+// Read returns key from the last good document.  The first Read fetches the document.
+func (h *HTTPReader) Read(ctx context.Context, key string) ([]byte, error) {
+	if err := h.ensureFetched(ctx); err != nil {
+		return nil, err
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.values[key], nil
+}
+
+// ReadMany returns keys from the document, fetching it only once
+func (h *HTTPReader) ReadMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	if err := h.ensureFetched(ctx); err != nil {
+		return nil, err
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ret := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		if b, exists := h.values[key]; exists {
+			ret[key] = b
+		}
+	}
+	return ret, nil
+}
+
+// ensureFetched fetches the document if it has never been fetched.  Concurrent first reads share one fetch.
+func (h *HTTPReader) ensureFetched(ctx context.Context) error {
+	h.start()
+	if h.isFetched() {
+		return nil
+	}
+	h.fetchMutex.Lock()
+	defer h.fetchMutex.Unlock()
+	// Another read may have fetched the document while this one waited
+	if h.isFetched() {
+		return nil
+	}
+	return h.fetchLocked(ctx)
+}
+
+func (h *HTTPReader) isFetched() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.fetched
+}
+
+// Watch executes callback when key changes inside the document.  A nil callback removes the watch.
+func (h *HTTPReader) Watch(_ context.Context, key string, callback func()) error {
+	h.start()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if callback == nil {
+		delete(h.watches, key)
+		return nil
+	}
+	if h.watches == nil {
+		h.watches = make(map[string]func())
+	}
+	h.watches[key] = callback
+	return nil
+}
+
+// Shutdown stops polling the document
+func (h *HTTPReader) Shutdown(ctx context.Context) error {
+	h.start()
+	h.mu.Lock()
+	select {
+	case <-h.onClose:
+	default:
+		close(h.onClose)
+	}
+	h.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *HTTPReader) start() {
+	h.startOnce.Do(func() {
+		h.onClose = make(chan struct{})
+		h.wg.Add(1)
+		go h.pollLoop()
+	})
+}
+
+func (h *HTTPReader) pollLoop() {
+	defer h.wg.Done()
+	for {
+		select {
+		case <-h.onClose:
+			return
+		case <-time.After(h.pollInterval()):
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), h.pollInterval())
+		if err := h.fetch(ctx); err != nil {
+			h.Hooks.onError("unable to fetch config document", h.URL, err)
+		}
+		cancel()
+	}
+}
+
+// fetch gets the document if it changed and executes the callbacks of watched keys whose value changed
+func (h *HTTPReader) fetch(ctx context.Context) error {
+	h.fetchMutex.Lock()
+	defer h.fetchMutex.Unlock()
+	return h.fetchLocked(ctx)
+}
+
+// fetchLocked is fetch for callers that hold fetchMutex
+func (h *HTTPReader) fetchLocked(ctx context.Context) error {
+	req, err := http.NewRequest(http.MethodGet, h.URL, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range h.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", "application/json")
+	h.mu.RLock()
+	if h.etag != "" {
+		req.Header.Set("If-None-Match", h.etag)
+	}
+	h.mu.RUnlock()
+	resp, err := h.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			h.Hooks.onError("unable to close response body", h.URL, err)
+		}
+	}()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	maxAge := parseMaxAge(resp.Header.Get("Cache-Control"))
+	if resp.StatusCode == http.StatusNotModified {
+		h.mu.Lock()
+		h.maxAge = maxAge
+		h.mu.Unlock()
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, h.URL)
+	}
+	values, err := flattenJSON(body, h.separator())
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	previous := h.values
+	h.values = values
+	h.etag = resp.Header.Get("ETag")
+	h.maxAge = maxAge
+	h.fetched = true
+	var toCall []func()
+	for key, callback := range h.watches {
+		oldValue, oldExists := previous[key]
+		newValue, newExists := values[key]
+		if oldExists != newExists || !bytes.Equal(oldValue, newValue) {
+			toCall = append(toCall, callback)
+		}
+	}
+	h.mu.Unlock()
+	for _, callback := range toCall {
+		callback()
+	}
+	return nil
+}
+
+func (h *HTTPReader) separator() string {
+	if h.Separator == "" {
+		return "."
+	}
+	return h.Separator
+}
+
+// parseMaxAge returns the max-age of a Cache-Control header, or zero if the response should not be cached
+func parseMaxAge(cacheControl string) time.Duration {
+	var maxAge time.Duration
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		if directive == "no-cache" || directive == "no-store" {
+			return 0
+		}
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+		seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+		if err == nil && seconds > 0 {
+			maxAge = time.Duration(seconds) * time.Second
+		}
+	}
+	return maxAge
+}
+
+// flattenJSON turns a JSON object into a map of keys to values
+func flattenJSON(body []byte, separator string) (map[string][]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("unable to decode config document: %v", err)
+	}
+	ret := make(map[string][]byte)
+	return ret, flattenInto(ret, "", doc, separator)
+}
+
+func flattenInto(into map[string][]byte, prefix string, doc map[string]json.RawMessage, separator string) error {
+	for k, raw := range doc {
+		key := prefix + k
+		raw = bytes.TrimSpace(raw)
+		switch {
+		case len(raw) == 0 || bytes.Equal(raw, []byte("null")):
+		case raw[0] == '{':
+			var nested map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &nested); err != nil {
+				return err
+			}
+			if err := flattenInto(into, key+separator, nested, separator); err != nil {
+				return err
+			}
+		case raw[0] == '"':
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return err
+			}
+			into[key] = []byte(s)
+		default:
+			into[key] = []byte(raw)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package distconf
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jsonServer serves a JSON document with an ETag, counting full responses and 304s
+type jsonServer struct {
+	mu          sync.Mutex
+	body        string
+	etag        string
+	down        bool
+	full        int64
+	notModified int64
+}
+
+func (j *jsonServer) set(body string, etag string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.body = body
+	j.etag = etag
+}
+
+func (j *jsonServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.down {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if req.Header.Get("Authorization") != "Bearer abc" {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	rw.Header().Set("Cache-Control", "max-age=0")
+	if req.Header.Get("If-None-Match") == j.etag {
+		atomic.AddInt64(&j.notModified, 1)
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+	atomic.AddInt64(&j.full, 1)
+	rw.Header().Set("ETag", j.etag)
+	_, err := rw.Write([]byte(j.body))
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestHTTPReader(t *testing.T) {
+	ctx := context.Background()
+	j := &jsonServer{}
+	j.set(`{"port": 80, "db": {"host": "a.com", "tls": true, "pool": {"size": 4}}, "gone": null, "list": [1, 2]}`, `"1"`)
+	s := httptest.NewServer(j)
+	defer s.Close()
+	h := &HTTPReader{
+		URL:          s.URL,
+		Header:       http.Header{"Authorization": []string{"Bearer abc"}},
+		PollInterval: time.Millisecond,
+	}
+	defer mustShutdown(t, h)
+
+	for key, expected := range map[string]string{"port": "80", "db.host": "a.com", "db.tls": "true", "db.pool.size": "4", "list": "[1, 2]"} {
+		b, err := h.Read(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(b), key)
+	}
+	for _, key := range []string{"gone", "db", "missing"} {
+		b, err := h.Read(ctx, key)
+		require.NoError(t, err)
+		assert.Nil(t, b, key)
+	}
+	values, err := h.ReadMany(ctx, []string{"port", "db.host", "gone"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"port": []byte("80"), "db.host": []byte("a.com")}, values)
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt64(&j.notModified) > 0
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&j.full))
+}
+
+func TestHTTPReader_concurrentFirstRead(t *testing.T) {
+	ctx := context.Background()
+	j := &jsonServer{}
+	j.set(`{"port": 80}`, `"1"`)
+	s := httptest.NewServer(j)
+	defer s.Close()
+	h := &HTTPReader{
+		URL:          s.URL,
+		Header:       http.Header{"Authorization": []string{"Bearer abc"}},
+		PollInterval: time.Hour,
+	}
+	defer mustShutdown(t, h)
+
+	// Reads that all start before the document is fetched make a single request
+	start := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			b, err := h.Read(ctx, "port")
+			assert.NoError(t, err)
+			assert.Equal(t, "80", string(b))
+		}()
+	}
+	close(start)
+	wg.Wait()
+	assert.Equal(t, int64(1), atomic.LoadInt64(&j.full))
+	assert.Equal(t, int64(0), atomic.LoadInt64(&j.notModified))
+}
+
+func TestHTTPReader_Watch(t *testing.T) {
+	ctx := context.Background()
+	j := &jsonServer{}
+	j.set(`{"port": 80, "host": "a.com"}`, `"1"`)
+	s := httptest.NewServer(j)
+	defer s.Close()
+	h := &HTTPReader{
+		URL:          s.URL,
+		Header:       http.Header{"Authorization": []string{"Bearer abc"}},
+		PollInterval: time.Millisecond,
+		Separator:    "_",
+	}
+	conf := &Distconf{
+		Readers: []Reader{h},
+	}
+	defer mustShutdown(t, h)
+	defer mustShutdown(t, conf)
+
+	port := conf.Int(ctx, "port", 1)
+	host := conf.Str(ctx, "host", "")
+	assert.Equal(t, int64(80), port.Get())
+	hostChanges := int64(0)
+	host.Watch(func(*Str, string) {
+		atomic.AddInt64(&hostChanges, 1)
+	})
+
+	j.set(`{"port": 8080, "host": "a.com"}`, `"2"`)
+	require.Eventually(t, func() bool {
+		return port.Get() == 8080
+	}, time.Second, time.Millisecond)
+
+	// The last good document stays while the endpoint is down
+	j.mu.Lock()
+	j.down = true
+	j.mu.Unlock()
+	time.Sleep(time.Millisecond * 20)
+	b, err := h.Read(ctx, "port")
+	require.NoError(t, err)
+	assert.Equal(t, "8080", string(b))
+	assert.Equal(t, int64(8080), port.Get())
+	assert.Equal(t, int64(0), atomic.LoadInt64(&hostChanges))
+}
+
+func TestHTTPReader_errors(t *testing.T) {
+	ctx := context.Background()
+	j := &jsonServer{}
+	j.set(`not json`, `"1"`)
+	s := httptest.NewServer(j)
+	defer s.Close()
+
+	h := &HTTPReader{URL: s.URL}
+	defer mustShutdown(t, h)
+	_, err := h.Read(ctx, "port")
+	assert.Error(t, err)
+
+	h2 := &HTTPReader{URL: s.URL, Header: http.Header{"Authorization": []string{"Bearer abc"}}}
+	defer mustShutdown(t, h2)
+	_, err = h2.Read(ctx, "port")
+	assert.Error(t, err)
+}
+
+func TestParseMaxAge(t *testing.T) {
+	assert.Equal(t, time.Duration(0), parseMaxAge(""))
+	assert.Equal(t, time.Minute, parseMaxAge("public, max-age=60"))
+	assert.Equal(t, time.Duration(0), parseMaxAge("max-age=60, no-cache"))
+	assert.Equal(t, time.Duration(0), parseMaxAge("max-age=abc"))
+}
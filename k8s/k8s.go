@@ -0,0 +1,463 @@
+// Package k8s allows distconf to read configuration directly from Kubernetes ConfigMaps and Secrets through the
+// Kubernetes API, without waiting for mounted volumes to update.
+package k8s
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cep21/distconf"
+)
+
+// Kind is the type of a Kubernetes object that holds configuration
+type Kind string
+
+const (
+	// ConfigMap objects use data as is, and binaryData base64 decoded
+	ConfigMap Kind = "configmaps"
+	// Secret objects have their data base64 decoded
+	Secret Kind = "secrets"
+)
+
+// Object is a single ConfigMap or Secret to read keys from
+type Object struct {
+	Kind Kind
+	Name string
+}
+
+// Reader serves distconf keys out of a list of ConfigMaps and Secrets.  Each object is kept in a local cache
+// with an informer style list and watch, so changes trigger Watch callbacks within seconds.  All public functions
+// are thread safe.
+type Reader struct {
+	// Host of the API server.  For example "https://kubernetes.default.svc"
+	Host string
+	// Namespace of every object in Objects
+	Namespace string
+	// Objects to read keys from.  The order is important, as keys in earlier objects are used first.
+	Objects []Object
+	// Token is the bearer token for the API server.  Ignored if TokenFile is set
+	Token string
+	// TokenFile contains the bearer token and is re-read for every request, since service account tokens rotate.
+	// Inside a pod this is usually /var/run/secrets/kubernetes.io/serviceaccount/token
+	TokenFile string
+	// Client is used for all HTTP requests.  Defaults to http.DefaultClient
+	Client *http.Client
+	// RetryInterval is how long to wait before retrying a failed list or watch.  Defaults to 5 seconds
+	RetryInterval time.Duration
+	// Hooks report errors that happen in the background
+	Hooks distconf.Hooks
+
+	startOnce sync.Once
+	onClose   chan struct{}
+	cancel    func()
+	wg        sync.WaitGroup
+	informers []*informer
+
+	mu      sync.Mutex
+	watches map[string]func()
+}
+
+var _ distconf.Reader = &Reader{}
+var _ distconf.Watcher = &Reader{}
+var _ distconf.Shutdownable = &Reader{}
+
+// errGone is returned when a watch's resourceVersion is too old and the object must be listed again
+var errGone = errors.New("resource version too old")
+
+// informer caches the data of a single object
+type informer struct {
+	object Object
+	// synced is closed after the first list attempt finishes
+	synced chan struct{}
+
+	mu      sync.RWMutex
+	data    map[string][]byte
+	listed  bool
+	listErr error
+}
+
+func (r *Reader) onError(msg string, key string, err error) {
+	if r.Hooks.OnError != nil {
+		r.Hooks.OnError(msg, key, err)
+	}
+}
+
+func (r *Reader) client() *http.Client {
+	if r.Client == nil {
+		return http.DefaultClient
+	}
+	return r.Client
+}
+
+func (r *Reader) retryInterval() time.Duration {
+	if r.RetryInterval == 0 {
+		return time.Second * 5
+	}
+	return r.RetryInterval
+}
+
+func (r *Reader) start() {
+	r.startOnce.Do(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		r.onClose = make(chan struct{})
+		r.cancel = cancel
+		r.informers = make([]*informer, 0, len(r.Objects))
+		for _, object := range r.Objects {
+			inf := &informer{
+				object: object,
+				synced: make(chan struct{}),
+			}
+			r.informers = append(r.informers, inf)
+			r.wg.Add(1)
+			go r.run(ctx, inf)
+		}
+	})
+}
+
+// Read returns key from the first object that has it.  The first Read waits for every object to be listed.
+func (r *Reader) Read(ctx context.Context, key string) ([]byte, error) {
+	r.start()
+	for _, inf := range r.informers {
+		select {
+		case <-inf.synced:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		inf.mu.RLock()
+		value, exists := inf.data[key]
+		err := inf.listErr
+		inf.mu.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return value, nil
+		}
+	}
+	return nil, nil
+}
+
+// Watch executes callback when key changes inside any object.  A nil callback removes the watch.
+func (r *Reader) Watch(_ context.Context, key string, callback func()) error {
+	r.start()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if callback == nil {
+		delete(r.watches, key)
+		return nil
+	}
+	if r.watches == nil {
+		r.watches = make(map[string]func())
+	}
+	r.watches[key] = callback
+	return nil
+}
+
+// Shutdown stops every list and watch
+func (r *Reader) Shutdown(ctx context.Context) error {
+	r.start()
+	r.mu.Lock()
+	select {
+	case <-r.onClose:
+	default:
+		close(r.onClose)
+		r.cancel()
+	}
+	r.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run lists then watches inf.object until shutdown, listing again whenever the watch is too old
+func (r *Reader) run(ctx context.Context, inf *informer) {
+	defer r.wg.Done()
+	syncOnce := sync.Once{}
+	markSynced := func() {
+		syncOnce.Do(func() {
+			close(inf.synced)
+		})
+	}
+	defer markSynced()
+	for {
+		resourceVersion, err := r.list(ctx, inf)
+		markSynced()
+		for err == nil {
+			resourceVersion, err = r.watch(ctx, inf, resourceVersion)
+		}
+		select {
+		case <-r.onClose:
+			return
+		default:
+		}
+		if err == errGone {
+			continue
+		}
+		r.onError("unable to list or watch kubernetes object", inf.object.Name, err)
+		select {
+		case <-r.onClose:
+			return
+		case <-time.After(r.retryInterval()):
+		}
+	}
+}
+
+func (r *Reader) collectionURL(object Object, params url.Values) string {
+	params.Set("fieldSelector", "metadata.name="+object.Name)
+	return strings.TrimRight(r.Host, "/") + "/api/v1/namespaces/" + url.PathEscape(r.Namespace) + "/" +
+		string(object.Kind) + "?" + params.Encode()
+}
+
+func (r *Reader) newRequest(ctx context.Context, u string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	token := r.Token
+	if r.TokenFile != "" {
+		b, err := ioutil.ReadFile(r.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
+
+// kubeObject is the part of a ConfigMap or Secret that Reader uses
+type kubeObject struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Data       map[string]string `json:"data"`
+	BinaryData map[string]string `json:"binaryData"`
+}
+
+// status is returned by the API server for errors, and inside ERROR watch events
+type status struct {
+	Kind    string `json:"kind"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (s status) err() error {
+	if s.Code == http.StatusGone {
+		return errGone
+	}
+	return fmt.Errorf("kubernetes API error %d: %s", s.Code, s.Message)
+}
+
+func (r *Reader) list(ctx context.Context, inf *informer) (string, error) {
+	req, err := r.newRequest(ctx, r.collectionURL(inf.object, url.Values{}))
+	if err == nil {
+		var resourceVersion string
+		resourceVersion, err = r.doList(req, inf)
+		if err == nil {
+			return resourceVersion, nil
+		}
+	}
+	inf.mu.Lock()
+	// Once listed, keep serving the last known data
+	if !inf.listed {
+		inf.listErr = err
+	}
+	inf.mu.Unlock()
+	return "", err
+}
+
+func (r *Reader) doList(req *http.Request, inf *informer) (string, error) {
+	resp, err := r.client().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer r.closeBody(resp)
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", statusError(resp.StatusCode, body)
+	}
+	var list struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []kubeObject `json:"items"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return "", err
+	}
+	var obj *kubeObject
+	for i := range list.Items {
+		if list.Items[i].Metadata.Name == inf.object.Name {
+			obj = &list.Items[i]
+		}
+	}
+	if err := r.update(inf, obj); err != nil {
+		return "", err
+	}
+	return list.Metadata.ResourceVersion, nil
+}
+
+// watch streams changes to inf.object, starting after resourceVersion.  It returns the last seen resourceVersion
+// when the server ends the watch normally.
+func (r *Reader) watch(ctx context.Context, inf *informer, resourceVersion string) (string, error) {
+	params := url.Values{}
+	params.Set("watch", "true")
+	params.Set("resourceVersion", resourceVersion)
+	params.Set("allowWatchBookmarks", "true")
+	req, err := r.newRequest(ctx, r.collectionURL(inf.object, params))
+	if err != nil {
+		return resourceVersion, err
+	}
+	resp, err := r.client().Do(req)
+	if err != nil {
+		return resourceVersion, err
+	}
+	defer r.closeBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return resourceVersion, err
+		}
+		return resourceVersion, statusError(resp.StatusCode, body)
+	}
+	decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var event struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := decoder.Decode(&event); err != nil {
+			if ctx.Err() != nil {
+				return resourceVersion, ctx.Err()
+			}
+			if err == io.EOF {
+				// The server closes watches after a timeout.  Start another one where this one left off.
+				return resourceVersion, nil
+			}
+			// A broken connection or a malformed event is an error, so the next watch waits RetryInterval
+			return resourceVersion, err
+		}
+		if event.Type == "ERROR" {
+			var s status
+			if err := json.Unmarshal(event.Object, &s); err != nil {
+				return resourceVersion, err
+			}
+			return resourceVersion, s.err()
+		}
+		var obj kubeObject
+		if err := json.Unmarshal(event.Object, &obj); err != nil {
+			return resourceVersion, err
+		}
+		resourceVersion = obj.Metadata.ResourceVersion
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			err = r.update(inf, &obj)
+		case "DELETED":
+			err = r.update(inf, nil)
+		}
+		if err != nil {
+			return resourceVersion, err
+		}
+	}
+}
+
+func (r *Reader) closeBody(resp *http.Response) {
+	if err := resp.Body.Close(); err != nil {
+		r.onError("unable to close response body", "", err)
+	}
+}
+
+func statusError(code int, body []byte) error {
+	var s status
+	if err := json.Unmarshal(body, &s); err != nil || s.Kind != "Status" {
+		s = status{Code: code, Message: strings.TrimSpace(string(body))}
+	}
+	if s.Code == 0 {
+		s.Code = code
+	}
+	return s.err()
+}
+
+// decode returns the key/value contents of obj, or nil if the object does not exist
+func decode(kind Kind, obj *kubeObject) (map[string][]byte, error) {
+	if obj == nil {
+		return nil, nil
+	}
+	ret := make(map[string][]byte, len(obj.Data)+len(obj.BinaryData))
+	for k, v := range obj.Data {
+		if kind == Secret {
+			b, err := base64.StdEncoding.DecodeString(v)
+			if err != nil {
+				return nil, fmt.Errorf("unable to decode secret key %s: %v", k, err)
+			}
+			ret[k] = b
+			continue
+		}
+		ret[k] = []byte(v)
+	}
+	for k, v := range obj.BinaryData {
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode binary key %s: %v", k, err)
+		}
+		ret[k] = b
+	}
+	return ret, nil
+}
+
+// update replaces the cached data of inf and executes the callbacks of watched keys that changed
+func (r *Reader) update(inf *informer, obj *kubeObject) error {
+	data, err := decode(inf.object.Kind, obj)
+	if err != nil {
+		return err
+	}
+	inf.mu.Lock()
+	previous := inf.data
+	inf.data = data
+	inf.listed = true
+	inf.listErr = nil
+	inf.mu.Unlock()
+
+	var toCall []func()
+	r.mu.Lock()
+	for key, callback := range r.watches {
+		oldValue, oldExists := previous[key]
+		newValue, newExists := data[key]
+		if oldExists != newExists || !bytes.Equal(oldValue, newValue) {
+			toCall = append(toCall, callback)
+		}
+	}
+	r.mu.Unlock()
+	for _, callback := range toCall {
+		callback()
+	}
+	return nil
+}
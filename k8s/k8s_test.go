@@ -0,0 +1,317 @@
+package k8s
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cep21/distconf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeEvent struct {
+	resourceVersion int
+	kind            Kind
+	eventType       string
+	object          kubeObject
+}
+
+// fakeAPIServer emulates list and watch of ConfigMaps and Secrets inside the default namespace
+type fakeAPIServer struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	version int
+	// Watches older than compacted get a 410 Gone
+	compacted int
+	objects   map[Kind]map[string]kubeObject
+	events    []fakeEvent
+	closed    bool
+	// goneNextWatch makes the next watch request fail with 410 Gone
+	goneNextWatch bool
+	// malformedNextWatch makes the next watch request stream an event that is not JSON
+	malformedNextWatch bool
+}
+
+func newFakeAPIServer() *fakeAPIServer {
+	f := &fakeAPIServer{
+		objects: map[Kind]map[string]kubeObject{
+			ConfigMap: {},
+			Secret:    {},
+		},
+	}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+func (f *fakeAPIServer) put(kind Kind, name string, data map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.version++
+	obj := kubeObject{Data: data}
+	obj.Metadata.Name = name
+	obj.Metadata.ResourceVersion = strconv.Itoa(f.version)
+	eventType := "MODIFIED"
+	if _, exists := f.objects[kind][name]; !exists {
+		eventType = "ADDED"
+	}
+	f.objects[kind][name] = obj
+	f.events = append(f.events, fakeEvent{resourceVersion: f.version, kind: kind, eventType: eventType, object: obj})
+	f.cond.Broadcast()
+}
+
+func (f *fakeAPIServer) delete(kind Kind, name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.version++
+	obj := f.objects[kind][name]
+	obj.Metadata.ResourceVersion = strconv.Itoa(f.version)
+	delete(f.objects[kind], name)
+	f.events = append(f.events, fakeEvent{resourceVersion: f.version, kind: kind, eventType: "DELETED", object: obj})
+	f.cond.Broadcast()
+}
+
+// compact forgets every event so far, forcing current watches to relist
+func (f *fakeAPIServer) compact() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.compacted = f.version
+	f.events = nil
+	f.cond.Broadcast()
+}
+
+func (f *fakeAPIServer) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	f.cond.Broadcast()
+}
+
+func (f *fakeAPIServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Authorization") != "Bearer token" {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	if len(parts) != 5 || parts[2] != "namespaces" || parts[3] != "default" {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+	kind := Kind(parts[4])
+	name := strings.TrimPrefix(req.URL.Query().Get("fieldSelector"), "metadata.name=")
+	if req.URL.Query().Get("watch") == "true" {
+		resourceVersion, err := strconv.Atoi(req.URL.Query().Get("resourceVersion"))
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.serveWatch(rw, req, kind, name, resourceVersion)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	list := map[string]interface{}{
+		"metadata": map[string]string{"resourceVersion": strconv.Itoa(f.version)},
+		"items":    []kubeObject{},
+	}
+	if obj, exists := f.objects[kind][name]; exists {
+		list["items"] = []kubeObject{obj}
+	}
+	must(json.NewEncoder(rw).Encode(list))
+}
+
+func (f *fakeAPIServer) serveWatch(rw http.ResponseWriter, req *http.Request, kind Kind, name string, resourceVersion int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if resourceVersion < f.compacted || f.goneNextWatch {
+		f.goneNextWatch = false
+		rw.WriteHeader(http.StatusGone)
+		must(json.NewEncoder(rw).Encode(status{Kind: "Status", Code: http.StatusGone, Message: "too old"}))
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	if f.malformedNextWatch {
+		f.malformedNextWatch = false
+		_, err := rw.Write([]byte("{not json"))
+		must(err)
+		return
+	}
+	rw.(http.Flusher).Flush()
+	go func() {
+		<-req.Context().Done()
+		f.mu.Lock()
+		f.cond.Broadcast()
+		f.mu.Unlock()
+	}()
+	compacted := f.compacted
+	for req.Context().Err() == nil && !f.closed {
+		if f.compacted != compacted {
+			must(json.NewEncoder(rw).Encode(map[string]interface{}{
+				"type":   "ERROR",
+				"object": status{Kind: "Status", Code: http.StatusGone, Message: "too old"},
+			}))
+			return
+		}
+		for _, e := range f.events {
+			if e.resourceVersion <= resourceVersion || e.kind != kind || e.object.Metadata.Name != name {
+				continue
+			}
+			resourceVersion = e.resourceVersion
+			must(json.NewEncoder(rw).Encode(map[string]interface{}{"type": e.eventType, "object": e.object}))
+		}
+		rw.(http.Flusher).Flush()
+		f.cond.Wait()
+	}
+}
+
+func must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+func mustShutdown(t *testing.T, s distconf.Shutdownable) {
+	require.NoError(t, s.Shutdown(context.Background()))
+}
+
+func setup(t *testing.T) (*fakeAPIServer, *Reader, func()) {
+	f := newFakeAPIServer()
+	s := httptest.NewServer(f)
+	r := &Reader{
+		Host:      s.URL,
+		Namespace: "default",
+		Token:     "token",
+		Objects: []Object{
+			{Kind: ConfigMap, Name: "app"},
+			{Kind: Secret, Name: "app-secrets"},
+		},
+		RetryInterval: time.Millisecond,
+	}
+	return f, r, func() {
+		mustShutdown(t, r)
+		f.close()
+		s.Close()
+	}
+}
+
+func TestReader_Read(t *testing.T) {
+	ctx := context.Background()
+	f, r, cleanup := setup(t)
+	defer cleanup()
+	f.put(ConfigMap, "app", map[string]string{"port": "80", "shared": "configmap"})
+	f.put(Secret, "app-secrets", map[string]string{
+		"password": base64.StdEncoding.EncodeToString([]byte("hunter2")),
+		"shared":   base64.StdEncoding.EncodeToString([]byte("secret")),
+	})
+
+	for key, expected := range map[string]string{"port": "80", "password": "hunter2", "shared": "configmap"} {
+		b, err := r.Read(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(b), key)
+	}
+	b, err := r.Read(ctx, "missing")
+	require.NoError(t, err)
+	assert.Nil(t, b)
+}
+
+func TestReader_Read_unauthorized(t *testing.T) {
+	ctx := context.Background()
+	_, r, cleanup := setup(t)
+	defer cleanup()
+	r.Token = "wrong"
+	_, err := r.Read(ctx, "port")
+	assert.Error(t, err)
+}
+
+func TestReader_Watch(t *testing.T) {
+	ctx := context.Background()
+	f, r, cleanup := setup(t)
+	defer cleanup()
+	f.put(ConfigMap, "app", map[string]string{"port": "80"})
+	d := &distconf.Distconf{
+		Readers: []distconf.Reader{r},
+	}
+	defer mustShutdown(t, d)
+
+	port := d.Int(ctx, "port", 1)
+	password := d.Str(ctx, "password", "")
+	assert.Equal(t, int64(80), port.Get())
+
+	f.put(ConfigMap, "app", map[string]string{"port": "8080"})
+	f.put(Secret, "app-secrets", map[string]string{"password": base64.StdEncoding.EncodeToString([]byte("hunter2"))})
+	require.Eventually(t, func() bool {
+		return port.Get() == 8080 && password.Get() == "hunter2"
+	}, time.Second, time.Millisecond)
+
+	f.delete(ConfigMap, "app")
+	require.Eventually(t, func() bool {
+		return port.Get() == 1
+	}, time.Second, time.Millisecond)
+
+	// A compacted history forces a relist, which must still pick up the change
+	f.compact()
+	f.put(ConfigMap, "app", map[string]string{"port": "9090"})
+	require.Eventually(t, func() bool {
+		return port.Get() == 9090
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, r.Watch(ctx, "port", nil))
+	f.put(ConfigMap, "app", map[string]string{"port": "1234"})
+	time.Sleep(time.Millisecond * 20)
+	assert.Equal(t, int64(9090), port.Get())
+}
+
+func TestReader_relistAfterGone(t *testing.T) {
+	ctx := context.Background()
+	f, r, cleanup := setup(t)
+	defer cleanup()
+	f.put(ConfigMap, "app", map[string]string{"port": "80"})
+	b, err := r.Read(ctx, "port")
+	require.NoError(t, err)
+	assert.Equal(t, "80", string(b))
+
+	// Both the current watch and the first watch after relisting fail with 410 Gone
+	f.mu.Lock()
+	f.goneNextWatch = true
+	f.mu.Unlock()
+	f.compact()
+	f.put(ConfigMap, "app", map[string]string{"port": "81"})
+	require.Eventually(t, func() bool {
+		b, err := r.Read(ctx, "port")
+		return err == nil && string(b) == "81"
+	}, time.Second, time.Millisecond)
+}
+
+func TestReader_watchError(t *testing.T) {
+	ctx := context.Background()
+	f, r, cleanup := setup(t)
+	defer cleanup()
+	var errs int64
+	r.Hooks.OnError = func(msg string, distconfKey string, err error) {
+		atomic.AddInt64(&errs, 1)
+	}
+	f.put(ConfigMap, "app", map[string]string{"port": "80"})
+	b, err := r.Read(ctx, "port")
+	require.NoError(t, err)
+	assert.Equal(t, "80", string(b))
+
+	// A watch that breaks, instead of ending normally, is reported and retried
+	f.mu.Lock()
+	f.malformedNextWatch = true
+	f.mu.Unlock()
+	f.compact()
+	f.put(ConfigMap, "app", map[string]string{"port": "81"})
+	require.Eventually(t, func() bool {
+		b, err := r.Read(ctx, "port")
+		return err == nil && string(b) == "81"
+	}, time.Second, time.Millisecond)
+	assert.NotZero(t, atomic.LoadInt64(&errs))
+}
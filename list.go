@@ -0,0 +1,83 @@
+package distconf
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Unregistered returns, sorted, the keys that a Reader implementing Lister has but that no code has registered, as a
+// key or as an alias.  These are usually misspelled or dead keys in a config store.
+func (c *Distconf) Unregistered(ctx context.Context) ([]string, error) {
+	listed, err := c.listAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.varsMutex.Lock()
+	defer c.varsMutex.Unlock()
+	for _, rv := range c.registeredVars {
+		for _, alias := range rv.options.aliases {
+			delete(listed, alias)
+		}
+	}
+	var ret []string
+	for key := range listed {
+		if _, exists := c.registeredVars[key]; !exists {
+			ret = append(ret, key)
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// Unused returns, sorted, the registered keys that no Reader implementing Lister has, under the key or any of its
+// aliases.  These variables always use their default, unless a Reader that is not a Lister sets them.
+func (c *Distconf) Unused(ctx context.Context) ([]string, error) {
+	listed, err := c.listAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.varsMutex.Lock()
+	defer c.varsMutex.Unlock()
+	var ret []string
+	for key, rv := range c.registeredVars {
+		if !anyListed(listed, key, rv.options.aliases) {
+			ret = append(ret, key)
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// anyListed returns true if key or one of its aliases is in listed
+func anyListed(listed map[string]struct{}, key string, aliases []string) bool {
+	if _, exists := listed[key]; exists {
+		return true
+	}
+	for _, alias := range aliases {
+		if _, exists := listed[alias]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+// listAll returns every key of every Reader that implements Lister
+func (c *Distconf) listAll(ctx context.Context) (map[string]struct{}, error) {
+	ret := make(map[string]struct{})
+	readers, _ := c.currentReaders()
+	for _, backing := range readers {
+		lister, ok := backing.(Lister)
+		if !ok {
+			continue
+		}
+		keys, err := lister.List(ctx, "")
+		if err != nil {
+			return nil, fmt.Errorf("unable to list keys of %T: %v", backing, err)
+		}
+		for _, key := range keys {
+			ret[key] = struct{}{}
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,58 @@
+package distconf
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingLister is a Lister that always errors
+type failingLister struct {
+	Mem
+}
+
+func (f *failingLister) List(ctx context.Context, prefix string) ([]string, error) {
+	return nil, errNope
+}
+
+func TestDistconf_Unregistered(t *testing.T) {
+	ctx := context.Background()
+	m := &Mem{}
+	require.NoError(t, m.Write(ctx, "port", []byte("8080")))
+	require.NoError(t, m.Write(ctx, "hots", []byte("a.com")))
+	conf := &Distconf{
+		Readers: []Reader{m, &CommandLine{Prefix: "--", Source: []string{"--timeout=1s", "--port=1"}}, &plainBacking{}},
+	}
+	defer mustShutdown(t, conf)
+	conf.Int(ctx, "port", 0)
+	conf.Str(ctx, "host", "")
+
+	unregistered, err := conf.Unregistered(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hots", "timeout"}, unregistered)
+	unused, err := conf.Unused(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"host"}, unused)
+
+	conf.Readers = append(conf.Readers, &failingLister{})
+	_, err = conf.Unregistered(ctx)
+	assert.Error(t, err)
+	_, err = conf.Unused(ctx)
+	assert.Error(t, err)
+}
+
+func TestMem_List(t *testing.T) {
+	ctx := context.Background()
+	m := &Mem{}
+	keys, err := m.List(ctx, "")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+	for _, key := range []string{"db.port", "db.host", "port"} {
+		require.NoError(t, m.Write(ctx, key, []byte("1")))
+	}
+	keys, err = m.List(ctx, "db.")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"db.host", "db.port"}, keys)
+}
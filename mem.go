@@ -2,17 +2,28 @@ package distconf
 
 import (
 	"context"
+	"sort"
+	"strings"
 	"sync"
 )
 
 type Mem struct {
-	vals    map[string][]byte
-	watches map[string]func()
-	mu      sync.RWMutex
+	vals        map[string][]byte
+	watches     map[string][]memWatch
+	nextWatchID uint64
+	mu          sync.RWMutex
+}
+
+type memWatch struct {
+	id       uint64
+	callback func()
 }
 
 var _ Reader = &Mem{}
 var _ Watcher = &Mem{}
+var _ Subscriber = &Mem{}
+var _ BatchReader = &Mem{}
+var _ Lister = &Mem{}
 
 func (m *Mem) Read(_ context.Context, key string) ([]byte, error) {
 	m.mu.RLock()
@@ -24,30 +35,95 @@ func (m *Mem) Read(_ context.Context, key string) ([]byte, error) {
 	return b, nil
 }
 
-func (m *Mem) Write(_ context.Context, key string, value []byte) error {
+func (m *Mem) ReadMany(_ context.Context, keys []string) (map[string][]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ret := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		if b, exists := m.vals[key]; exists {
+			ret[key] = b
+		}
+	}
+	return ret, nil
+}
+
+func (m *Mem) List(_ context.Context, prefix string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var ret []string
+	for key := range m.vals {
+		if strings.HasPrefix(key, prefix) {
+			ret = append(ret, key)
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+func (m *Mem) Write(ctx context.Context, key string, value []byte) error {
+	return m.WriteMany(ctx, map[string][]byte{key: value})
+}
+
+// WriteMany sets every key to its value, deleting keys with a nil value.  Watches are executed only after every
+// key is written, so they never see a partial update.
+func (m *Mem) WriteMany(_ context.Context, values map[string][]byte) error {
 	m.mu.Lock()
 	if m.vals == nil {
 		m.vals = make(map[string][]byte)
 	}
-	if value == nil {
-		delete(m.vals, key)
-	} else {
-		m.vals[key] = value
+	var toExec []func()
+	for key, value := range values {
+		if value == nil {
+			delete(m.vals, key)
+		} else {
+			m.vals[key] = value
+		}
+		for _, w := range m.watches[key] {
+			toExec = append(toExec, w.callback)
+		}
 	}
 	m.mu.Unlock()
-	if toExec, exists := m.watches[key]; exists {
-		toExec()
+	for _, callback := range toExec {
+		callback()
 	}
-
 	return nil
 }
 
+// Watch adds callback to the callbacks of key.  A nil callback removes every callback of key.  Use Subscribe to
+// remove a single callback.
 func (m *Mem) Watch(_ context.Context, key string, callback func()) error {
+	if callback == nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.watches, key)
+		return nil
+	}
+	m.Subscribe(key, callback)
+	return nil
+}
+
+// Subscribe adds callback to the callbacks of key, and returns a function that removes it
+func (m *Mem) Subscribe(key string, callback func()) (unsubscribe func()) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if m.watches == nil {
-		m.watches = make(map[string]func())
+		m.watches = make(map[string][]memWatch)
+	}
+	m.nextWatchID++
+	id := m.nextWatchID
+	m.watches[key] = append(m.watches[key], memWatch{id: id, callback: callback})
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		watches := m.watches[key]
+		for i, w := range watches {
+			if w.id == id {
+				m.watches[key] = append(watches[:i:i], watches[i+1:]...)
+				break
+			}
+		}
+		if len(m.watches[key]) == 0 {
+			delete(m.watches, key)
+		}
 	}
-	m.watches[key] = callback
-	return nil
 }
@@ -0,0 +1,112 @@
+package distconf
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMem_sharedByDistconfs(t *testing.T) {
+	ctx := context.Background()
+	m := &Mem{}
+	first := &Distconf{Readers: []Reader{m}}
+	second := &Distconf{Readers: []Reader{m}}
+	firstPort := first.Int(ctx, "port", 0)
+	secondPort := second.Int(ctx, "port", 0)
+	// Refreshing does not add more callbacks
+	first.Refresh(ctx, "port")
+
+	require.NoError(t, m.Write(ctx, "port", []byte("8080")))
+	assert.Equal(t, int64(8080), firstPort.Get())
+	assert.Equal(t, int64(8080), secondPort.Get())
+	m.mu.RLock()
+	assert.Len(t, m.watches["port"], 2)
+	m.mu.RUnlock()
+	mustShutdown(t, first)
+	mustShutdown(t, second)
+}
+
+func TestMem_sharedShutdown(t *testing.T) {
+	ctx := context.Background()
+	m := &Mem{}
+	first := &Distconf{Readers: []Reader{m}}
+	second := &Distconf{Readers: []Reader{m}}
+	third := &Distconf{Readers: []Reader{m}}
+	defer mustShutdown(t, second)
+	first.Int(ctx, "port", 0)
+	secondPort := second.Int(ctx, "port", 0)
+	thirdPort := third.Int(ctx, "port", 0)
+
+	// Shutting down or removing the Mem from one Distconf leaves the watches of the others
+	mustShutdown(t, first)
+	require.NoError(t, third.RemoveReader(ctx, m))
+	require.NoError(t, m.Write(ctx, "port", []byte("8080")))
+	assert.Equal(t, int64(8080), secondPort.Get())
+	assert.Equal(t, int64(0), thirdPort.Get())
+	m.mu.RLock()
+	assert.Len(t, m.watches["port"], 1)
+	m.mu.RUnlock()
+}
+
+func TestMem_Subscribe(t *testing.T) {
+	ctx := context.Background()
+	m := &Mem{}
+	var calls []string
+	unsubscribeA := m.Subscribe("key", func() { calls = append(calls, "a") })
+	unsubscribeB := m.Subscribe("key", func() { calls = append(calls, "b") })
+	require.NoError(t, m.Write(ctx, "key", []byte("1")))
+	assert.Equal(t, []string{"a", "b"}, calls)
+
+	unsubscribeA()
+	unsubscribeA()
+	require.NoError(t, m.Write(ctx, "key", []byte("2")))
+	assert.Equal(t, []string{"a", "b", "b"}, calls)
+	unsubscribeB()
+	m.mu.RLock()
+	assert.Empty(t, m.watches)
+	m.mu.RUnlock()
+
+	// A nil callback removes every callback
+	require.NoError(t, m.Watch(ctx, "key", func() { calls = append(calls, "c") }))
+	require.NoError(t, m.Watch(ctx, "key", nil))
+	require.NoError(t, m.Write(ctx, "key", nil))
+	assert.Equal(t, []string{"a", "b", "b"}, calls)
+}
+
+func TestMem_WriteMany(t *testing.T) {
+	ctx := context.Background()
+	m := &Mem{}
+	require.NoError(t, m.Write(ctx, "gone", []byte("1")))
+	var seen map[string][]byte
+	for _, key := range []string{"host", "port"} {
+		m.Subscribe(key, func() {
+			// Every callback sees every write
+			var err error
+			seen, err = m.ReadMany(ctx, []string{"host", "port", "gone"})
+			require.NoError(t, err)
+		})
+	}
+	require.NoError(t, m.WriteMany(ctx, map[string][]byte{"host": []byte("a.com"), "port": []byte("80"), "gone": nil}))
+	assert.Equal(t, map[string][]byte{"host": []byte("a.com"), "port": []byte("80")}, seen)
+}
+
+func TestMem_race(t *testing.T) {
+	ctx := context.Background()
+	m := &Mem{}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			m.Subscribe("key", func() {})()
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, m.Write(ctx, "key", []byte("1")))
+		}()
+	}
+	wg.Wait()
+}
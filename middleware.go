@@ -0,0 +1,373 @@
+package distconf
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Middleware wraps a Reader with extra behavior.  Every Middleware in this package applies its behavior to Read,
+// ReadVersioned and ReadMany, and forwards Watch, Subscribe and Shutdown to the wrapped Reader when it implements
+// Watcher, Subscriber or Shutdownable.  Versions are 0 if the wrapped Reader is not a VersionedReader, and ReadMany
+// reads one key at a time if it is not a BatchReader.
+type Middleware func(Reader) Reader
+
+// Wrap applies middlewares to r.  The first middleware is the outermost, so Wrap(r, WithRetry(b), WithTimeout(t))
+// times out each attempt while WithTimeout(t), WithRetry(b) times out all attempts together.
+func Wrap(r Reader, middlewares ...Middleware) Reader {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		r = middlewares[i](r)
+	}
+	return r
+}
+
+// clock lets tests control time
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// forwarder implements every optional interface of Reader by forwarding to reader.  Reads go through call, which
+// adds the behavior of the middleware.
+type forwarder struct {
+	reader Reader
+	call   func(ctx context.Context, read func(ctx context.Context) error) error
+}
+
+var _ VersionedReader = forwarder{}
+var _ BatchReader = forwarder{}
+var _ Subscriber = forwarder{}
+
+// wrapper is a Reader that wraps another Reader
+type wrapper interface {
+	wrapped() Reader
+}
+
+func (f forwarder) wrapped() Reader {
+	return f.reader
+}
+
+// Read key from the wrapped Reader
+func (f forwarder) Read(ctx context.Context, key string) ([]byte, error) {
+	value, _, err := f.ReadVersioned(ctx, key)
+	return value, err
+}
+
+// ReadVersioned reads key with the wrapped Reader's ReadVersioned, or with Read and a version of 0 if it is not a
+// VersionedReader
+func (f forwarder) ReadVersioned(ctx context.Context, key string) ([]byte, int64, error) {
+	var value []byte
+	var version int64
+	err := f.call(ctx, func(ctx context.Context) error {
+		var err error
+		value, version, err = readVersioned(ctx, f.reader, key)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return value, version, nil
+}
+
+// ReadMany reads keys with the wrapped Reader's ReadMany, or one key at a time if it is not a BatchReader
+func (f forwarder) ReadMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	var values map[string][]byte
+	err := f.call(ctx, func(ctx context.Context) error {
+		var err error
+		values, err = readMany(ctx, f.reader, keys)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Watch forwards to the wrapped Reader if it is a Watcher
+func (f forwarder) Watch(ctx context.Context, key string, callback func()) error {
+	if w, ok := f.reader.(Watcher); ok {
+		return w.Watch(ctx, key, callback)
+	}
+	return nil
+}
+
+// Subscribe forwards to the wrapped Reader if it is a Subscriber
+func (f forwarder) Subscribe(key string, callback func()) func() {
+	return subscribe(f.reader, key, callback)
+}
+
+// Shutdown forwards to the wrapped Reader if it is Shutdownable
+func (f forwarder) Shutdown(ctx context.Context) error {
+	if s, ok := f.reader.(Shutdownable); ok {
+		return s.Shutdown(ctx)
+	}
+	return nil
+}
+
+// WithTimeout makes Read return context.DeadlineExceeded if the wrapped Reader takes longer than timeout.  The
+// wrapped Read is abandoned, not stopped, if it ignores its context.
+func WithTimeout(timeout time.Duration) Middleware {
+	return func(r Reader) Reader {
+		t := &timeoutReader{
+			timeout: timeout,
+			clock:   realClock{},
+		}
+		t.forwarder = forwarder{reader: r, call: t.call}
+		return t
+	}
+}
+
+type timeoutReader struct {
+	forwarder
+	timeout time.Duration
+	clock   clock
+}
+
+type readResult struct {
+	value   []byte
+	version int64
+	err     error
+}
+
+func (t *timeoutReader) call(ctx context.Context, read func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// Buffered so an abandoned read does not leak its goroutine forever
+	done := make(chan error, 1)
+	go func() {
+		done <- read(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-t.clock.After(t.timeout):
+		return context.DeadlineExceeded
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Backoff returns how long to wait before retry number attempt, starting at 1.  Returning false stops retrying.
+type Backoff func(attempt int) (time.Duration, bool)
+
+// ExponentialBackoff waits initial before the first retry and doubles the wait each retry, up to max.  It stops
+// after maxRetries retries.
+func ExponentialBackoff(initial time.Duration, max time.Duration, maxRetries int) Backoff {
+	return func(attempt int) (time.Duration, bool) {
+		if attempt > maxRetries {
+			return 0, false
+		}
+		wait := initial
+		for i := 1; i < attempt && wait < max; i++ {
+			wait *= 2
+		}
+		if wait > max {
+			wait = max
+		}
+		return wait, true
+	}
+}
+
+// WithRetry retries a failing Read while backoff allows it.  The last error is returned if every attempt fails.
+func WithRetry(backoff Backoff) Middleware {
+	return func(r Reader) Reader {
+		retry := &retryReader{
+			backoff: backoff,
+			clock:   realClock{},
+		}
+		retry.forwarder = forwarder{reader: r, call: retry.call}
+		return retry
+	}
+}
+
+type retryReader struct {
+	forwarder
+	backoff Backoff
+	clock   clock
+}
+
+func (r *retryReader) call(ctx context.Context, read func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := read(ctx)
+		if err == nil {
+			return nil
+		}
+		wait, retry := r.backoff(attempt)
+		if !retry {
+			return err
+		}
+		select {
+		case <-r.clock.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// CircuitState is the state of a circuit breaker
+type CircuitState int
+
+const (
+	// CircuitClosed passes every Read through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails every Read with ErrCircuitOpen
+	CircuitOpen
+	// CircuitHalfOpen lets a single Read through to test if the wrapped Reader recovered
+	CircuitHalfOpen
+)
+
+func (c CircuitState) String() string {
+	switch c {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// ErrCircuitOpen is returned by Read while a circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreakerConfig configures WithCircuitBreaker
+type CircuitBreakerConfig struct {
+	// Name is passed to Hooks.OnCircuitStateChange
+	Name string
+	// FailureThreshold is how many consecutive failed Reads open the circuit.  Defaults to 5
+	FailureThreshold int
+	// Cooldown is how long the circuit stays open before letting a Read test the wrapped Reader.  Defaults to
+	// 10 seconds
+	Cooldown time.Duration
+	// Hooks are told about state changes
+	Hooks Hooks
+}
+
+// WithCircuitBreaker stops calling a Reader that keeps failing, so callers fail fast and fall back to other
+// Readers instead of waiting on a broken backend.
+func WithCircuitBreaker(config CircuitBreakerConfig) Middleware {
+	return func(r Reader) Reader {
+		c := &circuitBreakerReader{
+			config: config,
+			clock:  realClock{},
+		}
+		c.forwarder = forwarder{reader: r, call: c.call}
+		return c
+	}
+}
+
+type circuitBreakerReader struct {
+	forwarder
+	config CircuitBreakerConfig
+	clock  clock
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	// probing is true while a half-open Read is in flight
+	probing bool
+}
+
+func (c *circuitBreakerReader) failureThreshold() int {
+	if c.config.FailureThreshold == 0 {
+		return 5
+	}
+	return c.config.FailureThreshold
+}
+
+func (c *circuitBreakerReader) cooldown() time.Duration {
+	if c.config.Cooldown == 0 {
+		return time.Second * 10
+	}
+	return c.config.Cooldown
+}
+
+// setState changes state and returns a function that reports the change.  Must hold c.mu.
+func (c *circuitBreakerReader) setState(to CircuitState) func() {
+	from := c.state
+	if from == to {
+		return func() {}
+	}
+	c.state = to
+	if to == CircuitOpen {
+		c.openedAt = c.clock.Now()
+	}
+	return func() {
+		c.config.Hooks.onCircuitStateChange(c.config.Name, from, to)
+	}
+}
+
+// allow returns false if Read should fail fast, and true for probe if the Read tests a half-open circuit
+func (c *circuitBreakerReader) allow() (allowed bool, probe bool) {
+	c.mu.Lock()
+	report := func() {}
+	allowed = true
+	switch c.state {
+	case CircuitOpen:
+		if c.clock.Now().Sub(c.openedAt) < c.cooldown() {
+			allowed = false
+			break
+		}
+		report = c.setState(CircuitHalfOpen)
+		c.probing = true
+		probe = true
+	case CircuitHalfOpen:
+		allowed = !c.probing
+		c.probing = true
+		probe = allowed
+	}
+	c.mu.Unlock()
+	report()
+	return allowed, probe
+}
+
+// record updates the state with the result of a Read.  Only the probe decides a half-open circuit, because any other
+// Read in flight started before the circuit opened.
+func (c *circuitBreakerReader) record(err error, probe bool) {
+	c.mu.Lock()
+	report := func() {}
+	switch {
+	case probe:
+		c.probing = false
+		if err == nil {
+			c.failures = 0
+			report = c.setState(CircuitClosed)
+		} else {
+			report = c.setState(CircuitOpen)
+		}
+	case c.state != CircuitClosed:
+		// Started before the circuit opened
+	case err == nil:
+		c.failures = 0
+	default:
+		c.failures++
+		if c.failures >= c.failureThreshold() {
+			report = c.setState(CircuitOpen)
+		}
+	}
+	c.mu.Unlock()
+	report()
+}
+
+func (c *circuitBreakerReader) call(ctx context.Context, read func(ctx context.Context) error) error {
+	allowed, probe := c.allow()
+	if !allowed {
+		return ErrCircuitOpen
+	}
+	err := read(ctx)
+	c.record(err, probe)
+	return err
+}
@@ -0,0 +1,407 @@
+package distconf
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock only moves when Advance is called
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	f.waiters = append(f.waiters, fakeWaiter{at: f.now.Add(d), ch: ch})
+	return ch
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	remaining := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.at.After(f.now) {
+			remaining = append(remaining, w)
+			continue
+		}
+		w.ch <- f.now
+	}
+	f.waiters = remaining
+}
+
+// waitForWaiters blocks until n calls to After are pending
+func (f *fakeClock) waitForWaiters(t *testing.T, n int) {
+	require.Eventually(t, func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return len(f.waiters) == n
+	}, time.Second, time.Millisecond)
+}
+
+// countingBacking fails the first failures Reads, and blocks Reads while block is not nil
+type countingBacking struct {
+	Mem
+	failures int64
+	reads    int64
+	block    chan struct{}
+}
+
+func (c *countingBacking) Read(ctx context.Context, key string) ([]byte, error) {
+	if atomic.AddInt64(&c.reads, 1) <= atomic.LoadInt64(&c.failures) {
+		return nil, errNope
+	}
+	if c.block != nil {
+		<-c.block
+	}
+	return c.Mem.Read(ctx, key)
+}
+
+func TestWithTimeout(t *testing.T) {
+	ctx := context.Background()
+	clk := &fakeClock{}
+	backing := &countingBacking{block: make(chan struct{})}
+	defer close(backing.block)
+	r := WithTimeout(time.Second)(backing).(*timeoutReader)
+	r.clock = clk
+
+	errs := make(chan error)
+	go func() {
+		_, err := r.Read(ctx, "key")
+		errs <- err
+	}()
+	clk.waitForWaiters(t, 1)
+	clk.Advance(time.Second)
+	assert.Equal(t, context.DeadlineExceeded, <-errs)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err := r.Read(canceled, "key")
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestWithRetry(t *testing.T) {
+	ctx := context.Background()
+	clk := &fakeClock{}
+	backing := &countingBacking{failures: 2}
+	require.NoError(t, backing.Write(ctx, "key", []byte("value")))
+	r := WithRetry(ExponentialBackoff(time.Second, time.Minute, 2))(backing).(*retryReader)
+	r.clock = clk
+
+	type result struct {
+		value []byte
+		err   error
+	}
+	results := make(chan result)
+	read := func() {
+		go func() {
+			b, err := r.Read(ctx, "key")
+			results <- result{b, err}
+		}()
+	}
+	read()
+	clk.waitForWaiters(t, 1)
+	clk.Advance(time.Second)
+	clk.waitForWaiters(t, 1)
+	clk.Advance(time.Second * 2)
+	res := <-results
+	require.NoError(t, res.err)
+	assert.Equal(t, "value", string(res.value))
+
+	// Out of retries
+	atomic.StoreInt64(&backing.reads, 0)
+	atomic.StoreInt64(&backing.failures, 3)
+	read()
+	clk.waitForWaiters(t, 1)
+	clk.Advance(time.Second)
+	clk.waitForWaiters(t, 1)
+	clk.Advance(time.Second * 2)
+	assert.Equal(t, errNope, (<-results).err)
+	assert.Equal(t, int64(3), atomic.LoadInt64(&backing.reads))
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := ExponentialBackoff(time.Second, time.Second*3, 3)
+	for attempt, expected := range []time.Duration{time.Second, time.Second * 2, time.Second * 3} {
+		wait, ok := b(attempt + 1)
+		assert.True(t, ok)
+		assert.Equal(t, expected, wait)
+	}
+	_, ok := b(4)
+	assert.False(t, ok)
+}
+
+func TestWithCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	clk := &fakeClock{}
+	backing := &countingBacking{failures: 3}
+	require.NoError(t, backing.Write(ctx, "key", []byte("value")))
+	var changes []CircuitState
+	r := WithCircuitBreaker(CircuitBreakerConfig{
+		Name:             "test",
+		FailureThreshold: 2,
+		Cooldown:         time.Second,
+		Hooks: Hooks{
+			OnCircuitStateChange: func(name string, from CircuitState, to CircuitState) {
+				assert.Equal(t, "test", name)
+				changes = append(changes, to)
+			},
+		},
+	})(backing).(*circuitBreakerReader)
+	r.clock = clk
+
+	for i := 0; i < 2; i++ {
+		_, err := r.Read(ctx, "key")
+		assert.Equal(t, errNope, err)
+	}
+	_, err := r.Read(ctx, "key")
+	assert.Equal(t, ErrCircuitOpen, err)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&backing.reads))
+
+	// The half open probe fails, so the circuit opens again
+	clk.Advance(time.Second)
+	_, err = r.Read(ctx, "key")
+	assert.Equal(t, errNope, err)
+	_, err = r.Read(ctx, "key")
+	assert.Equal(t, ErrCircuitOpen, err)
+
+	clk.Advance(time.Second)
+	b, err := r.Read(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "value", string(b))
+	assert.Equal(t, []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}, changes)
+	assert.Equal(t, "half-open", CircuitHalfOpen.String())
+	assert.Equal(t, "unknown", CircuitState(-1).String())
+}
+
+// gatedBacking blocks each Read until an error is sent on the channel of its key, after sending the key on started
+type gatedBacking struct {
+	started chan string
+	results map[string]chan error
+}
+
+func (g *gatedBacking) Read(_ context.Context, key string) ([]byte, error) {
+	g.started <- key
+	return nil, <-g.results[key]
+}
+
+func TestWithCircuitBreaker_staleReads(t *testing.T) {
+	ctx := context.Background()
+	clk := &fakeClock{}
+	backing := &gatedBacking{
+		started: make(chan string),
+		results: make(map[string]chan error),
+	}
+	for _, key := range []string{"fails", "stale-success", "stale-failure", "probe"} {
+		backing.results[key] = make(chan error, 1)
+	}
+	var mu sync.Mutex
+	var changes []CircuitState
+	r := WithCircuitBreaker(CircuitBreakerConfig{
+		FailureThreshold: 1,
+		Cooldown:         time.Second,
+		Hooks: Hooks{
+			OnCircuitStateChange: func(name string, from CircuitState, to CircuitState) {
+				mu.Lock()
+				defer mu.Unlock()
+				changes = append(changes, to)
+			},
+		},
+	})(backing).(*circuitBreakerReader)
+	r.clock = clk
+	startRead := func(key string) chan error {
+		errs := make(chan error, 1)
+		go func() {
+			_, err := r.Read(ctx, key)
+			errs <- err
+		}()
+		select {
+		case started := <-backing.started:
+			require.Equal(t, key, started)
+		case err := <-errs:
+			require.FailNow(t, "read did not reach the backing", "%s: %v", key, err)
+		}
+		return errs
+	}
+
+	// Both stale reads start while the circuit is closed, then a failure opens it
+	staleSuccess := startRead("stale-success")
+	staleFailure := startRead("stale-failure")
+	backing.results["fails"] <- errNope
+	assert.Equal(t, errNope, <-startRead("fails"))
+
+	// A stale failure does not restart the cooldown
+	clk.Advance(time.Second / 2)
+	backing.results["stale-failure"] <- errNope
+	assert.Equal(t, errNope, <-staleFailure)
+	clk.Advance(time.Second / 2)
+	probe := startRead("probe")
+
+	// A stale success does not close the half-open circuit while the probe is in flight
+	backing.results["stale-success"] <- nil
+	assert.NoError(t, <-staleSuccess)
+	_, err := r.Read(ctx, "probe")
+	assert.Equal(t, ErrCircuitOpen, err)
+
+	backing.results["probe"] <- errNope
+	assert.Equal(t, errNope, <-probe)
+	mu.Lock()
+	assert.Equal(t, []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen}, changes)
+	mu.Unlock()
+}
+
+func TestWrap(t *testing.T) {
+	ctx := context.Background()
+	m := &Mem{}
+	r := Wrap(m, WithCircuitBreaker(CircuitBreakerConfig{}), WithRetry(ExponentialBackoff(time.Millisecond, time.Millisecond, 1)), WithTimeout(time.Second))
+	conf := &Distconf{Readers: []Reader{r}}
+	defer mustShutdown(t, conf)
+	val := conf.Str(ctx, "key", "")
+	// Watches are forwarded through every middleware
+	require.NoError(t, m.Write(ctx, "key", []byte("value")))
+	assert.Equal(t, "value", val.Get())
+
+	sr := WithTimeout(time.Second)(&SnapshotCache{Reader: m})
+	assert.NoError(t, sr.(Shutdownable).Shutdown(ctx))
+	assert.NoError(t, WithTimeout(time.Second)(&allErrorBacking{}).(Shutdownable).Shutdown(ctx))
+}
+
+// wrappers returns a constructor for every wrapper of this package.  Snapshots are saved in dir.
+func wrappers(dir string) map[string]func(Reader) Reader {
+	retry := WithRetry(ExponentialBackoff(time.Millisecond, time.Millisecond, 1))
+	return map[string]func(Reader) Reader{
+		"timeout":         WithTimeout(time.Minute),
+		"retry":           retry,
+		"circuit breaker": WithCircuitBreaker(CircuitBreakerConfig{}),
+		"cache": func(r Reader) Reader {
+			return &CachingReader{Reader: r, NegativeTTL: -1}
+		},
+		"snapshot": func(r Reader) Reader {
+			return &SnapshotCache{Reader: r, Path: filepath.Join(dir, "snapshot.json"), SaveInterval: time.Hour}
+		},
+		"nested": func(r Reader) Reader {
+			return Wrap(&CachingReader{Reader: r, NegativeTTL: -1}, retry, WithTimeout(time.Minute))
+		},
+	}
+}
+
+func TestWrappers_ReadVersioned(t *testing.T) {
+	ctx := context.Background()
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	for name, wrap := range wrappers(dir) {
+		backing := &versionedBacking{}
+		r := wrap(backing)
+		conf := &Distconf{Readers: []Reader{r}}
+		backing.set("b.com", 2)
+		host := conf.Str(ctx, "host", "")
+		assert.Equal(t, "b.com", host.Get(), name)
+
+		// An out of order read of an older version is still ignored
+		backing.set("a.com", 1)
+		if c, ok := r.(*CachingReader); ok {
+			c.Invalidate("host")
+		}
+		conf.Refresh(ctx, "host")
+		assert.Equal(t, "b.com", host.Get(), name)
+		mustShutdown(t, conf)
+
+		// Readers that are not versioned have a version of 0
+		_, version, err := wrap(&plainBacking{}).(VersionedReader).ReadVersioned(ctx, "host")
+		require.NoError(t, err, name)
+		assert.Equal(t, int64(0), version, name)
+	}
+}
+
+func TestWrappers_ReadMany(t *testing.T) {
+	ctx := context.Background()
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	for name, wrap := range wrappers(dir) {
+		batch := &batchBacking{}
+		require.NoError(t, batch.Write(ctx, "port", []byte("8080")))
+		require.NoError(t, batch.Write(ctx, "host", []byte("a.com")))
+		conf := &Distconf{Readers: []Reader{wrap(batch)}}
+		conf.Preload(ctx, "port", "host", "missing")
+		assert.Equal(t, int64(1), batch.readManys, name)
+		assert.Equal(t, int64(8080), conf.Int(ctx, "port", 0).Get(), name)
+		assert.Equal(t, "a.com", conf.Str(ctx, "host", "").Get(), name)
+		assert.Equal(t, int64(0), batch.reads, name)
+		mustShutdown(t, conf)
+
+		// Readers that can not batch are read one key at a time, so Preload keeps their versions
+		plain := &plainBacking{}
+		require.NoError(t, plain.m.Write(ctx, "port", []byte("1")))
+		r := wrap(plain)
+		assert.False(t, canBatch(r), name)
+		values, err := r.(BatchReader).ReadMany(ctx, []string{"port", "missing"})
+		require.NoError(t, err, name)
+		assert.Equal(t, map[string][]byte{"port": []byte("1")}, values, name)
+		assert.Equal(t, int64(2), plain.reads, name)
+	}
+
+	// Errors of ReadMany go through the wrapper
+	batch := &batchBacking{broken: true}
+	r := WithRetry(ExponentialBackoff(time.Millisecond, time.Millisecond, 2))(batch)
+	_, err := r.(BatchReader).ReadMany(ctx, []string{"port"})
+	assert.Equal(t, errNope, err)
+	assert.Equal(t, int64(3), batch.readManys)
+}
+
+func TestWrappers_Subscribe(t *testing.T) {
+	ctx := context.Background()
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	for name, wrap := range wrappers(dir) {
+		m := &Mem{}
+		first := &Distconf{Readers: []Reader{wrap(m)}}
+		second := &Distconf{Readers: []Reader{wrap(m)}}
+		first.Int(ctx, "port", 0)
+		secondPort := second.Int(ctx, "port", 0)
+
+		// Shutting down one Distconf leaves the watches of the other
+		mustShutdown(t, first)
+		require.NoError(t, m.Write(ctx, "port", []byte("8080")))
+		assert.Equal(t, int64(8080), secondPort.Get(), name)
+		m.mu.RLock()
+		assert.Len(t, m.watches["port"], 1, name)
+		m.mu.RUnlock()
+		mustShutdown(t, second)
+
+		// Watchers that are not Subscribers are still watched with Watch
+		assert.True(t, canSubscribe(wrap(m).(Watcher)), name)
+		assert.False(t, canSubscribe(wrap(&allErrorBacking{}).(Watcher)), name)
+		conf := &Distconf{Readers: []Reader{wrap(&allErrorBacking{})}}
+		var errs int64
+		conf.Hooks.OnError = func(msg string, key string, err error) {
+			if msg == "Unable to watch for config var" {
+				atomic.AddInt64(&errs, 1)
+			}
+		}
+		conf.Int(ctx, "port", 0)
+		assert.Equal(t, int64(1), atomic.LoadInt64(&errs), name)
+	}
+}
@@ -0,0 +1,124 @@
+// Package natskv allows distconf to read configuration from a NATS JetStream key-value bucket.  It needs Go 1.20 or
+// later, which the key-value API of the nats.go jetstream package requires.
+package natskv
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/cep21/distconf"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Reader serves distconf keys from a JetStream key-value bucket.  Watches share a single watcher on the
+// entire bucket that dispatches updates to the callback of each key.  All public functions are thread safe.
+type Reader struct {
+	// KV is the bucket to read from.  Reader does not own the underlying connection and will not close it.
+	KV jetstream.KeyValue
+
+	mu       sync.Mutex
+	watches  map[string]func()
+	watcher  jetstream.KeyWatcher
+	cancel   func()
+	shutdown bool
+	wg       sync.WaitGroup
+}
+
+var _ distconf.Reader = &Reader{}
+var _ distconf.Watcher = &Reader{}
+var _ distconf.Shutdownable = &Reader{}
+var _ distconf.VersionedReader = &Reader{}
+
+var errShutdown = errors.New("reader is shut down")
+
+// Read returns the latest value of key inside the bucket.  Deleted and purged keys are missing.
+func (r *Reader) Read(ctx context.Context, key string) ([]byte, error) {
+	value, _, err := r.ReadVersioned(ctx, key)
+	return value, err
+}
+
+// ReadVersioned returns the value of key and its revision in the bucket
+func (r *Reader) ReadVersioned(ctx context.Context, key string) ([]byte, int64, error) {
+	entry, err := r.KV.Get(ctx, key)
+	if err == jetstream.ErrKeyNotFound {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return entry.Value(), int64(entry.Revision()), nil
+}
+
+// Watch executes callback any time key is put, deleted or purged.  A nil callback removes the watch.  The first
+// Watch starts the bucket-wide watcher.
+func (r *Reader) Watch(_ context.Context, key string, callback func()) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if callback == nil {
+		delete(r.watches, key)
+		return nil
+	}
+	if r.shutdown {
+		return errShutdown
+	}
+	if r.watcher == nil {
+		// The watcher outlives the context of any single Watch call, so it gets its own
+		ctx, cancel := context.WithCancel(context.Background())
+		watcher, err := r.KV.WatchAll(ctx, jetstream.UpdatesOnly())
+		if err != nil {
+			cancel()
+			return err
+		}
+		r.watcher = watcher
+		r.cancel = cancel
+		r.wg.Add(1)
+		go r.dispatch(watcher.Updates())
+	}
+	if r.watches == nil {
+		r.watches = make(map[string]func())
+	}
+	r.watches[key] = callback
+	return nil
+}
+
+// dispatch sends every update of the bucket to the callback of its key
+func (r *Reader) dispatch(updates <-chan jetstream.KeyValueEntry) {
+	defer r.wg.Done()
+	for entry := range updates {
+		if entry == nil {
+			continue
+		}
+		r.mu.Lock()
+		callback := r.watches[entry.Key()]
+		r.mu.Unlock()
+		if callback != nil {
+			callback()
+		}
+	}
+}
+
+// Shutdown stops the bucket watcher
+func (r *Reader) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	r.shutdown = true
+	watcher, cancel := r.watcher, r.cancel
+	r.watcher, r.cancel = nil, nil
+	r.mu.Unlock()
+	if watcher == nil {
+		return nil
+	}
+	err := watcher.Stop()
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
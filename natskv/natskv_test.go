@@ -0,0 +1,125 @@
+package natskv
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cep21/distconf"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustShutdown(t *testing.T, s distconf.Shutdownable) {
+	require.NoError(t, s.Shutdown(context.Background()))
+}
+
+// makeBucket starts an embedded nats-server and returns a bucket on it, plus a cleanup function
+func makeBucket(t *testing.T) (jetstream.KeyValue, func()) {
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		NoLog:     true,
+		NoSigs:    true,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	require.NoError(t, err)
+	s.Start()
+	require.True(t, s.ReadyForConnections(time.Second*10))
+	nc, err := nats.Connect(s.ClientURL())
+	require.NoError(t, err)
+	js, err := jetstream.New(nc)
+	require.NoError(t, err)
+	kv, err := js.CreateKeyValue(context.Background(), jetstream.KeyValueConfig{Bucket: "config"})
+	require.NoError(t, err)
+	return kv, func() {
+		nc.Close()
+		s.Shutdown()
+		s.WaitForShutdown()
+	}
+}
+
+func TestReader_Read(t *testing.T) {
+	ctx := context.Background()
+	kv, cleanup := makeBucket(t)
+	defer cleanup()
+	_, err := kv.Put(ctx, "a", []byte("1"))
+	require.NoError(t, err)
+	r := &Reader{KV: kv}
+	defer mustShutdown(t, r)
+
+	b, err := r.Read(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(b))
+
+	revision, err := kv.Put(ctx, "a", []byte("2"))
+	require.NoError(t, err)
+	b, version, err := r.ReadVersioned(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "2", string(b))
+	assert.Equal(t, int64(revision), version)
+
+	b, err = r.Read(ctx, "missing")
+	require.NoError(t, err)
+	assert.Nil(t, b)
+
+	require.NoError(t, kv.Delete(ctx, "a"))
+	b, err = r.Read(ctx, "a")
+	require.NoError(t, err)
+	assert.Nil(t, b)
+
+	_, err = r.Read(ctx, "invalid key*")
+	assert.Error(t, err)
+}
+
+func TestReader_Watch(t *testing.T) {
+	ctx := context.Background()
+	kv, cleanup := makeBucket(t)
+	defer cleanup()
+	_, err := kv.Put(ctx, "port", []byte("80"))
+	require.NoError(t, err)
+	r := &Reader{KV: kv}
+	d := &distconf.Distconf{
+		Readers: []distconf.Reader{r},
+	}
+	defer mustShutdown(t, r)
+	defer mustShutdown(t, d)
+
+	port := d.Int(ctx, "port", 1)
+	host := d.Str(ctx, "host", "localhost")
+	assert.Equal(t, int64(80), port.Get())
+
+	_, err = kv.Put(ctx, "port", []byte("8080"))
+	require.NoError(t, err)
+	_, err = kv.Put(ctx, "host", []byte("example.com"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return port.Get() == 8080 && host.Get() == "example.com"
+	}, time.Second*5, time.Millisecond)
+
+	require.NoError(t, kv.Purge(ctx, "port"))
+	require.Eventually(t, func() bool {
+		return port.Get() == 1
+	}, time.Second*5, time.Millisecond)
+
+	require.NoError(t, r.Watch(ctx, "host", nil))
+	_, err = kv.Put(ctx, "host", []byte("ignored.com"))
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond * 50)
+	assert.Equal(t, "example.com", host.Get())
+}
+
+func TestReader_Shutdown(t *testing.T) {
+	ctx := context.Background()
+	kv, cleanup := makeBucket(t)
+	defer cleanup()
+	r := &Reader{KV: kv}
+	mustShutdown(t, r)
+	assert.Equal(t, errShutdown, r.Watch(ctx, "a", func() {}))
+	assert.NoError(t, r.Watch(ctx, "a", nil))
+	mustShutdown(t, r)
+}
@@ -0,0 +1,139 @@
+package distconf
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// VarOption changes how a single registered variable behaves.  Options are only used the first time a key is
+// registered.
+type VarOption func(*varOptions)
+
+type varOptions struct {
+	errorMode        ErrorMode
+	errorGracePeriod time.Duration
+	description      string
+	owner            string
+	tags             []string
+	deprecated       bool
+	replacementKey   string
+	aliases          []string
+	// min and max are nil if the variable has no bound
+	min   *float64
+	max   *float64
+	oneOf []string
+}
+
+func newVarOptions(opts []VarOption) varOptions {
+	var ret varOptions
+	for _, opt := range opts {
+		opt(&ret)
+	}
+	return ret
+}
+
+// WithErrorMode sets the ErrorMode of this variable, overriding Distconf.ErrorMode
+func WithErrorMode(mode ErrorMode) VarOption {
+	return func(o *varOptions) {
+		o.errorMode = mode
+	}
+}
+
+// WithErrorGracePeriod sets how long an ErrorSticky variable keeps its value while a Reader errors, overriding
+// Distconf.ErrorGracePeriod
+func WithErrorGracePeriod(gracePeriod time.Duration) VarOption {
+	return func(o *varOptions) {
+		o.errorGracePeriod = gracePeriod
+	}
+}
+
+// WithDescription documents what this variable does.  It is shown in Distconf.Info.
+func WithDescription(description string) VarOption {
+	return func(o *varOptions) {
+		o.description = description
+	}
+}
+
+// WithOwner records who owns this variable, like a team name or an email.  It is shown in Distconf.Info.
+func WithOwner(owner string) VarOption {
+	return func(o *varOptions) {
+		o.owner = owner
+	}
+}
+
+// WithTags adds free form tags to this variable, like "security" or "experimental".  They are shown in
+// Distconf.Info.
+func WithTags(tags ...string) VarOption {
+	return func(o *varOptions) {
+		o.tags = append(o.tags, tags...)
+	}
+}
+
+// Deprecated marks this variable as deprecated in favor of replacementKey, which may be empty if there is no
+// replacement.  Hooks.OnDeprecatedKey is called whenever a Reader supplies a value for it.
+func Deprecated(replacementKey string) VarOption {
+	return func(o *varOptions) {
+		o.deprecated = true
+		o.replacementKey = replacementKey
+	}
+}
+
+// WithAliases lets this variable also be read from oldKeys, so a key can be renamed without changing every Reader
+// at once.  Each Reader is checked for the key, then for each alias in order, before moving on to the next Reader.
+// Hooks.OnAliasUsed is called whenever an alias supplies the value.  Aliases should not be registered as keys
+// themselves.
+func WithAliases(oldKeys ...string) VarOption {
+	return func(o *varOptions) {
+		o.aliases = append(o.aliases, oldKeys...)
+	}
+}
+
+// WithMin rejects Int and Float values below min.  A rejected value is reported to Hooks.OnError and the variable
+// keeps its current value, like a value that does not parse.
+func WithMin(min float64) VarOption {
+	return func(o *varOptions) {
+		o.min = &min
+	}
+}
+
+// WithMax rejects Int and Float values above max, like WithMin
+func WithMax(max float64) VarOption {
+	return func(o *varOptions) {
+		o.max = &max
+	}
+}
+
+// WithOneOf rejects Str values that are not one of values, like WithMin
+func WithOneOf(values ...string) VarOption {
+	return func(o *varOptions) {
+		o.oneOf = append(o.oneOf, values...)
+	}
+}
+
+// validate returns an error if value breaks a constraint of the options.  A nil value resets the default, which is
+// not checked.  Values that are not numbers skip WithMin and WithMax, so the variable reports its own parse error.
+func (o *varOptions) validate(value []byte) error {
+	if value == nil {
+		return nil
+	}
+	if o.min != nil || o.max != nil {
+		if f, err := strconv.ParseFloat(string(value), 64); err == nil {
+			if o.min != nil && f < *o.min {
+				return fmt.Errorf("%s is below the minimum %v", value, *o.min)
+			}
+			if o.max != nil && f > *o.max {
+				return fmt.Errorf("%s is above the maximum %v", value, *o.max)
+			}
+		}
+	}
+	if len(o.oneOf) == 0 {
+		return nil
+	}
+	for _, allowed := range o.oneOf {
+		if string(value) == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not one of %v", value, o.oneOf)
+}
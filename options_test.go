@@ -0,0 +1,151 @@
+package distconf
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVarOptions_metadata(t *testing.T) {
+	ctx := context.Background()
+	_, conf := makeConf()
+	defer mustShutdown(t, conf)
+	conf.Int(ctx, "port", 80, WithDescription("Port to listen on"), WithOwner("infra"), WithTags("network", "startup"), WithTags("public"))
+	conf.Str(ctx, "host", "")
+	conf.Str(ctx, "old.host", "", Deprecated("host"))
+
+	var info map[string]distInfo
+	require.NoError(t, json.Unmarshal([]byte(conf.Info().String()), &info))
+	assert.Equal(t, "Port to listen on", info["port"].Description)
+	assert.Equal(t, "infra", info["port"].Owner)
+	assert.Equal(t, []string{"network", "startup", "public"}, info["port"].Tags)
+	assert.False(t, info["port"].Deprecated)
+	assert.True(t, info["old.host"].Deprecated)
+	assert.Equal(t, "host", info["old.host"].ReplacementKey)
+	assert.Empty(t, info["host"].Description)
+	assert.Empty(t, info["host"].Tags)
+}
+
+func TestVarOptions_validators(t *testing.T) {
+	ctx := context.Background()
+	mem, conf := makeConf()
+	defer mustShutdown(t, conf)
+	var errs []string
+	conf.Hooks.OnError = func(msg string, distconfKey string, err error) {
+		errs = append(errs, distconfKey+": "+err.Error())
+	}
+	port := conf.Int(ctx, "port", 80, WithMin(1), WithMax(65535))
+	mode := conf.Str(ctx, "mode", "fast", WithOneOf("fast", "slow"))
+
+	require.NoError(t, mem.Write(ctx, "port", []byte("8080")))
+	require.NoError(t, mem.Write(ctx, "mode", []byte("slow")))
+	assert.Equal(t, int64(8080), port.Get())
+	assert.Equal(t, "slow", mode.Get())
+	assert.Empty(t, errs)
+
+	// Rejected values keep the current value
+	require.NoError(t, mem.Write(ctx, "port", []byte("0")))
+	require.NoError(t, mem.Write(ctx, "port", []byte("70000")))
+	require.NoError(t, mem.Write(ctx, "mode", []byte("medium")))
+	assert.Equal(t, int64(8080), port.Get())
+	assert.Equal(t, "slow", mode.Get())
+	assert.Equal(t, []string{
+		"port: 0 is below the minimum 1",
+		"port: 70000 is above the maximum 65535",
+		"mode: medium is not one of [fast slow]",
+	}, errs)
+
+	// Removing the value still resets the default
+	require.NoError(t, mem.Write(ctx, "mode", nil))
+	assert.Equal(t, "fast", mode.Get())
+}
+
+func TestDeprecated_hook(t *testing.T) {
+	ctx := context.Background()
+	mem, conf := makeConf()
+	defer mustShutdown(t, conf)
+	type deprecation struct {
+		key         string
+		replacement string
+	}
+	var seen []deprecation
+	conf.Hooks.OnDeprecatedKey = func(distconfKey string, replacementKey string) {
+		seen = append(seen, deprecation{key: distconfKey, replacement: replacementKey})
+	}
+	oldHost := conf.Str(ctx, "old.host", "default", Deprecated("host"))
+	gone := conf.Int(ctx, "gone", 1, Deprecated(""))
+	conf.Str(ctx, "host", "")
+	// Defaults alone do not use a deprecated key
+	assert.Empty(t, seen)
+
+	require.NoError(t, mem.Write(ctx, "old.host", []byte("a.com")))
+	require.NoError(t, mem.Write(ctx, "gone", []byte("2")))
+	require.NoError(t, mem.Write(ctx, "host", []byte("b.com")))
+	assert.Equal(t, "a.com", oldHost.Get())
+	assert.Equal(t, int64(2), gone.Get())
+	assert.Equal(t, []deprecation{{key: "old.host", replacement: "host"}, {key: "gone"}}, seen)
+
+	require.NoError(t, mem.Write(ctx, "old.host", nil))
+	assert.Equal(t, "default", oldHost.Get())
+	assert.Len(t, seen, 2)
+}
+
+func TestWithAliases(t *testing.T) {
+	ctx := context.Background()
+	primary := &Mem{}
+	fallback := &Mem{}
+	require.NoError(t, primary.Write(ctx, "dbhost", []byte("a.com")))
+	require.NoError(t, fallback.Write(ctx, "db.host", []byte("b.com")))
+	conf := &Distconf{Readers: []Reader{primary, fallback}}
+	var aliasesUsed []string
+	conf.Hooks.OnAliasUsed = func(distconfKey string, alias string) {
+		aliasesUsed = append(aliasesUsed, distconfKey+"="+alias)
+	}
+	host := conf.Str(ctx, "db.host", "", WithAliases("database_host", "dbhost"))
+	// Every alias of a Reader is checked before the next Reader
+	assert.Equal(t, "a.com", host.Get())
+	assert.Equal(t, []string{"db.host=dbhost"}, aliasesUsed)
+
+	// Aliases are watched, and checked in order
+	require.NoError(t, primary.Write(ctx, "database_host", []byte("c.com")))
+	assert.Equal(t, "c.com", host.Get())
+	assert.Equal(t, []string{"db.host=dbhost", "db.host=database_host"}, aliasesUsed)
+
+	// The key itself wins over its aliases
+	require.NoError(t, primary.Write(ctx, "db.host", []byte("d.com")))
+	assert.Equal(t, "d.com", host.Get())
+	assert.Len(t, aliasesUsed, 2)
+
+	require.NoError(t, primary.WriteMany(ctx, map[string][]byte{"db.host": nil, "database_host": nil, "dbhost": nil}))
+	assert.Equal(t, "b.com", host.Get())
+
+	var info map[string]distInfo
+	require.NoError(t, json.Unmarshal([]byte(conf.Info().String()), &info))
+	assert.Equal(t, []string{"database_host", "dbhost"}, info["db.host"].Aliases)
+
+	mustShutdown(t, conf)
+	primary.mu.RLock()
+	assert.Empty(t, primary.watches)
+	primary.mu.RUnlock()
+}
+
+func TestWithAliases_list(t *testing.T) {
+	ctx := context.Background()
+	m := &Mem{}
+	require.NoError(t, m.Write(ctx, "old.port", []byte("8080")))
+	require.NoError(t, m.Write(ctx, "unknown", []byte("1")))
+	conf := &Distconf{Readers: []Reader{m}}
+	defer mustShutdown(t, conf)
+	conf.Int(ctx, "port", 0, WithAliases("old.port"))
+	conf.Str(ctx, "host", "", WithAliases("old.host"))
+
+	unregistered, err := conf.Unregistered(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"unknown"}, unregistered)
+	unused, err := conf.Unused(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"host"}, unused)
+}
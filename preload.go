@@ -0,0 +1,139 @@
+package distconf
+
+import (
+	"context"
+	"time"
+)
+
+// preloadTTL is how long a preloaded key waits to be registered.  Older results are dropped, because the key is not
+// watched until it is registered and its value may have changed.
+const preloadTTL = time.Minute
+
+// Preload fetches keys from every Reader before they are registered, so the first Int, Str, etc. of those keys
+// does not need its own round trip.  Readers that implement BatchReader get a single ReadMany for all keys still
+// missing, in priority order.  Other Readers are read one key at a time.  Preloaded values are only used for the
+// first registration of a key within a minute, and keys that are already registered are skipped.
+func (c *Distconf) Preload(ctx context.Context, keys ...string) {
+	c.varsMutex.Lock()
+	remaining := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if _, exists := c.registeredVars[key]; !exists {
+			remaining = append(remaining, key)
+		}
+	}
+	c.varsMutex.Unlock()
+
+	readers, generation := c.currentReaders()
+	results := make(map[string][]readResult, len(remaining))
+	for _, backing := range readers {
+		if len(remaining) == 0 {
+			break
+		}
+		found := preloadFrom(ctx, backing, remaining)
+		stillMissing := remaining[:0]
+		for _, key := range remaining {
+			res := found[key]
+			results[key] = append(results[key], res)
+			if res.err != nil || res.value == nil {
+				stillMissing = append(stillMissing, key)
+			}
+		}
+		remaining = stillMissing
+	}
+
+	c.preloadMutex.Lock()
+	defer c.preloadMutex.Unlock()
+	if _, current := c.currentReaders(); current != generation {
+		// The results no longer line up with the Readers
+		return
+	}
+	now := c.now()
+	// Drop keys that were preloaded but never registered
+	for key, preloaded := range c.preloaded {
+		if !now.Before(preloaded.expiresAt) {
+			delete(c.preloaded, key)
+		}
+	}
+	if c.preloaded == nil {
+		c.preloaded = make(map[string]preloadedKey, len(results))
+	}
+	for key, res := range results {
+		c.preloaded[key] = preloadedKey{generation: generation, results: res, expiresAt: now.Add(preloadTTL)}
+	}
+}
+
+// preloadedKey is what Preload read for a single key
+type preloadedKey struct {
+	// generation of the Readers the results were read from
+	generation uint64
+	// results has one readResult per Reader, stopping at the first Reader that had the key
+	results []readResult
+	// expiresAt is when the results are too old to use
+	expiresAt time.Time
+}
+
+// clearPreloaded forgets every preloaded key.  Used when the Readers change and on Shutdown.
+func (c *Distconf) clearPreloaded() {
+	c.preloadMutex.Lock()
+	defer c.preloadMutex.Unlock()
+	c.preloaded = nil
+}
+
+// preloadFrom reads keys from backing, with ReadMany if it can batch.  Versions are only known for other Readers.
+func preloadFrom(ctx context.Context, backing Reader, keys []string) map[string]readResult {
+	ret := make(map[string]readResult, len(keys))
+	if canBatch(backing) {
+		values, err := readMany(ctx, backing, keys)
+		for _, key := range keys {
+			ret[key] = readResult{value: values[key], err: err}
+		}
+		return ret
+	}
+	for _, key := range keys {
+		value, version, err := readVersioned(ctx, backing, key)
+		ret[key] = readResult{value: value, version: version, err: err}
+	}
+	return ret
+}
+
+// takePreloaded removes and returns what Preload read for key, unless it expired
+func (c *Distconf) takePreloaded(key string) preloadedKey {
+	c.preloadMutex.Lock()
+	defer c.preloadMutex.Unlock()
+	res, exists := c.preloaded[key]
+	delete(c.preloaded, key)
+	if !exists || !c.now().Before(res.expiresAt) {
+		return preloadedKey{}
+	}
+	return res
+}
+
+// canBatch returns true if r is a BatchReader that is not just a wrapper of a Reader that reads one key at a time
+func canBatch(r Reader) bool {
+	for {
+		w, ok := r.(wrapper)
+		if !ok {
+			_, ok = r.(BatchReader)
+			return ok
+		}
+		r = w.wrapped()
+	}
+}
+
+// readMany reads keys from r, with ReadMany if it is a BatchReader or one key at a time if it is not
+func readMany(ctx context.Context, r Reader, keys []string) (map[string][]byte, error) {
+	if batch, ok := r.(BatchReader); ok {
+		return batch.ReadMany(ctx, keys)
+	}
+	ret := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		value, err := r.Read(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if value != nil {
+			ret[key] = value
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,132 @@
+package distconf
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchBacking counts calls to ReadMany and Read
+type batchBacking struct {
+	Mem
+	readManys int64
+	reads     int64
+	broken    bool
+}
+
+func (b *batchBacking) Read(ctx context.Context, key string) ([]byte, error) {
+	atomic.AddInt64(&b.reads, 1)
+	return b.Mem.Read(ctx, key)
+}
+
+func (b *batchBacking) ReadMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	atomic.AddInt64(&b.readManys, 1)
+	if b.broken {
+		return nil, errNope
+	}
+	return b.Mem.ReadMany(ctx, keys)
+}
+
+// plainBacking is a Reader that is not a BatchReader
+type plainBacking struct {
+	m     Mem
+	reads int64
+}
+
+func (p *plainBacking) Read(ctx context.Context, key string) ([]byte, error) {
+	atomic.AddInt64(&p.reads, 1)
+	return p.m.Read(ctx, key)
+}
+
+func TestDistconf_Preload(t *testing.T) {
+	ctx := context.Background()
+	batch := &batchBacking{}
+	plain := &plainBacking{}
+	require.NoError(t, batch.Write(ctx, "port", []byte("8080")))
+	require.NoError(t, plain.m.Write(ctx, "port", []byte("1")))
+	require.NoError(t, plain.m.Write(ctx, "host", []byte("a.com")))
+	conf := &Distconf{Readers: []Reader{batch, plain}}
+	defer mustShutdown(t, conf)
+
+	conf.Preload(ctx, "port", "host", "missing")
+	assert.Equal(t, int64(1), batch.readManys)
+	// Only keys the batch reader did not have are read from the next Reader
+	assert.Equal(t, int64(2), plain.reads)
+
+	port := conf.Int(ctx, "port", 0)
+	host := conf.Str(ctx, "host", "")
+	missing := conf.Str(ctx, "missing", "default")
+	assert.Equal(t, int64(8080), port.Get())
+	assert.Equal(t, "a.com", host.Get())
+	assert.Equal(t, "default", missing.Get())
+	assert.Equal(t, int64(0), batch.reads)
+	assert.Equal(t, int64(2), plain.reads)
+
+	// Watches are registered as usual
+	require.NoError(t, batch.Write(ctx, "host", []byte("b.com")))
+	assert.Equal(t, "b.com", host.Get())
+
+	// Registered keys are not preloaded again
+	conf.Preload(ctx, "port")
+	assert.Equal(t, int64(1), batch.readManys)
+}
+
+func TestDistconf_Preload_error(t *testing.T) {
+	ctx := context.Background()
+	batch := &batchBacking{broken: true}
+	fallback := &Mem{}
+	require.NoError(t, batch.Write(ctx, "port", []byte("8080")))
+	require.NoError(t, fallback.Write(ctx, "port", []byte("1")))
+	var errs []string
+	conf := &Distconf{
+		Readers: []Reader{batch, fallback},
+		Hooks: Hooks{
+			OnError: func(msg string, distconfKey string, err error) {
+				errs = append(errs, distconfKey)
+			},
+		},
+	}
+	defer mustShutdown(t, conf)
+
+	conf.Preload(ctx, "port")
+	assert.Equal(t, int64(1), conf.Int(ctx, "port", 0).Get())
+	assert.Equal(t, []string{"port"}, errs)
+	assert.Equal(t, int64(0), batch.reads)
+}
+
+func TestDistconf_Preload_expires(t *testing.T) {
+	ctx := context.Background()
+	batch := &batchBacking{}
+	require.NoError(t, batch.Write(ctx, "port", []byte("8080")))
+	now := time.Unix(1000, 0)
+	conf := &Distconf{
+		Readers: []Reader{batch},
+		nowFunc: func() time.Time {
+			return now
+		},
+	}
+	defer mustShutdown(t, conf)
+
+	conf.Preload(ctx, "port", "unused")
+	now = now.Add(preloadTTL)
+	// The next Preload drops keys that were never registered
+	conf.Preload(ctx, "host")
+	conf.preloadMutex.Lock()
+	assert.Len(t, conf.preloaded, 1)
+	conf.preloadMutex.Unlock()
+
+	// Expired values are read again
+	require.NoError(t, batch.Write(ctx, "port", []byte("9090")))
+	assert.Equal(t, int64(9090), conf.Int(ctx, "port", 0).Get())
+	assert.Equal(t, int64(1), batch.reads)
+
+	// Shutdown forgets the rest
+	mustShutdown(t, conf)
+	conf.preloadMutex.Lock()
+	assert.Empty(t, conf.preloaded)
+	conf.preloadMutex.Unlock()
+}
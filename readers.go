@@ -0,0 +1,99 @@
+package distconf
+
+import (
+	"context"
+	"errors"
+)
+
+var errReaderNotFound = errors.New("reader is not one of the Readers")
+
+// currentReaders returns a copy of Readers and how many times they have changed
+func (c *Distconf) currentReaders() ([]Reader, uint64) {
+	c.readersMutex.RLock()
+	defer c.readersMutex.RUnlock()
+	ret := make([]Reader, len(c.Readers))
+	copy(ret, c.Readers)
+	return ret, c.readersGeneration
+}
+
+// AddReader inserts r into Readers at index priority, where 0 is checked first.  A priority past the end of Readers
+// appends r.  Every registered key is then refreshed, which watches r if it is a Watcher.  The returned error is
+// from the refresh, like RefreshAll.
+func (c *Distconf) AddReader(ctx context.Context, r Reader, priority int) error {
+	c.readersMutex.Lock()
+	if priority < 0 {
+		priority = 0
+	}
+	if priority > len(c.Readers) {
+		priority = len(c.Readers)
+	}
+	readers := make([]Reader, 0, len(c.Readers)+1)
+	readers = append(readers, c.Readers[:priority]...)
+	readers = append(readers, r)
+	readers = append(readers, c.Readers[priority:]...)
+	c.Readers = readers
+	c.readersGeneration++
+	c.readersMutex.Unlock()
+	c.clearPreloaded()
+	return c.RefreshAll(ctx)
+}
+
+// RemoveReader removes r from Readers, stops watching it, refreshes every registered key against the remaining
+// Readers and then shuts r down if it is Shutdownable.  It returns an error if r is not one of the Readers, the
+// error of Shutdown, or the error of the refresh, in that order.
+func (c *Distconf) RemoveReader(ctx context.Context, r Reader) error {
+	c.readersMutex.Lock()
+	index := -1
+	for i, existing := range c.Readers {
+		if sameInstance(existing, r) {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		c.readersMutex.Unlock()
+		return errReaderNotFound
+	}
+	readers := make([]Reader, 0, len(c.Readers)-1)
+	readers = append(readers, c.Readers[:index]...)
+	readers = append(readers, c.Readers[index+1:]...)
+	c.Readers = readers
+	c.readersGeneration++
+	c.readersMutex.Unlock()
+	c.clearPreloaded()
+
+	if w, ok := r.(Watcher); ok {
+		c.unregisterWatches(ctx, w)
+	}
+	refreshErr := c.RefreshAll(ctx)
+	if s, ok := r.(Shutdownable); ok {
+		if err := s.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	return refreshErr
+}
+
+// unregisterWatches removes every watch registered on w
+func (c *Distconf) unregisterWatches(ctx context.Context, w Watcher) {
+	removed := make(map[string]*registeredWatch)
+	c.registeredWatchesMutex.Lock()
+	for key, watches := range c.registeredWatches {
+		remaining := watches[:0]
+		for _, existing := range watches {
+			if sameInstance(existing.watcher, w) {
+				removed[key] = &registeredWatch{watcher: existing.watcher, unsubscribe: existing.unsubscribe}
+				continue
+			}
+			remaining = append(remaining, existing)
+		}
+		c.registeredWatches[key] = remaining
+	}
+	// Unlock early so we don't get in deadlock if Watch() somehow executes code that gets back here
+	c.registeredWatchesMutex.Unlock()
+	for key, watch := range removed {
+		if err := watch.unwatch(ctx, key); err != nil {
+			c.Hooks.onError("error unregistering watch", key, err)
+		}
+	}
+}
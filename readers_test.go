@@ -0,0 +1,120 @@
+package distconf
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// shutdownBacking counts calls to Shutdown
+type shutdownBacking struct {
+	Mem
+	shutdowns int64
+}
+
+func (s *shutdownBacking) Shutdown(ctx context.Context) error {
+	atomic.AddInt64(&s.shutdowns, 1)
+	return nil
+}
+
+// blockingBacking blocks the first Read after started is set until release is closed
+type blockingBacking struct {
+	Mem
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingBacking) Read(ctx context.Context, key string) ([]byte, error) {
+	if b.started != nil {
+		close(b.started)
+		<-b.release
+	}
+	return b.Mem.Read(ctx, key)
+}
+
+func TestDistconf_RemoveReader_duringRefresh(t *testing.T) {
+	ctx := context.Background()
+	removed := &blockingBacking{}
+	conf := &Distconf{Readers: []Reader{removed}}
+	defer mustShutdown(t, conf)
+	port := conf.Int(ctx, "port", 0)
+
+	removed.started = make(chan struct{})
+	removed.release = make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conf.Refresh(ctx, "port")
+	}()
+	<-removed.started
+	require.NoError(t, conf.RemoveReader(ctx, removed))
+	close(removed.release)
+	<-done
+
+	// The refresh that started before the removal does not watch the removed reader again
+	conf.registeredWatchesMutex.Lock()
+	assert.Empty(t, conf.registeredWatches["port"])
+	conf.registeredWatchesMutex.Unlock()
+	removed.mu.RLock()
+	assert.Empty(t, removed.watches)
+	removed.mu.RUnlock()
+	require.NoError(t, removed.Write(ctx, "port", []byte("8080")))
+	assert.Equal(t, int64(0), port.Get())
+}
+
+func TestDistconf_AddReader(t *testing.T) {
+	ctx := context.Background()
+	base := &Mem{}
+	require.NoError(t, base.Write(ctx, "port", []byte("1")))
+	conf := &Distconf{Readers: []Reader{base}}
+	defer mustShutdown(t, conf)
+	port := conf.Int(ctx, "port", 0)
+	host := conf.Str(ctx, "host", "")
+
+	remote := &shutdownBacking{}
+	require.NoError(t, remote.Write(ctx, "port", []byte("8080")))
+	require.NoError(t, conf.AddReader(ctx, remote, 0))
+	assert.Equal(t, int64(8080), port.Get())
+
+	// The new reader is watched
+	require.NoError(t, remote.Write(ctx, "host", []byte("a.com")))
+	assert.Equal(t, "a.com", host.Get())
+
+	// Out of range priorities are clamped
+	low := &Mem{}
+	require.NoError(t, conf.AddReader(ctx, low, 100))
+	require.NoError(t, conf.AddReader(ctx, &plainBacking{}, -1))
+	readers, _ := conf.currentReaders()
+	require.Len(t, readers, 4)
+	assert.Equal(t, low, readers[3])
+
+	require.NoError(t, conf.RemoveReader(ctx, remote))
+	assert.Equal(t, int64(1), port.Get())
+	assert.Equal(t, "", host.Get())
+	assert.Equal(t, int64(1), atomic.LoadInt64(&remote.shutdowns))
+	conf.registeredWatchesMutex.Lock()
+	for _, watches := range conf.registeredWatches {
+		assert.NotContains(t, watches, remote)
+	}
+	conf.registeredWatchesMutex.Unlock()
+
+	assert.Equal(t, errReaderNotFound, conf.RemoveReader(ctx, remote))
+}
+
+func TestDistconf_AddReader_preload(t *testing.T) {
+	ctx := context.Background()
+	base := &Mem{}
+	require.NoError(t, base.Write(ctx, "port", []byte("1")))
+	conf := &Distconf{Readers: []Reader{base}}
+	defer mustShutdown(t, conf)
+	conf.Preload(ctx, "port")
+
+	// Preloaded values are forgotten when the Readers change
+	remote := &Mem{}
+	require.NoError(t, remote.Write(ctx, "port", []byte("8080")))
+	require.NoError(t, conf.AddReader(ctx, remote, 0))
+	assert.Equal(t, int64(8080), conf.Int(ctx, "port", 0).Get())
+}
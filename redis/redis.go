@@ -0,0 +1,410 @@
+// Package redis allows distconf to read configuration from redis strings or the fields of a redis hash.
+package redis
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cep21/distconf"
+)
+
+// Reader reads distconf keys out of redis.  Watches use keyspace notifications when the server has them enabled
+// and fall back to polling watched keys when it does not.  All public functions are thread safe.
+type Reader struct {
+	// Address of the redis server.  Defaults to "localhost:6379"
+	Address string
+	// Password, if set, is sent with AUTH on every new connection
+	Password string
+	// DB is the redis database to SELECT
+	DB int
+	// Hash, if set, makes distconf keys fields of this hash.  Otherwise, distconf keys are redis string keys.
+	Hash string
+	// Dial creates connections to redis.  Defaults to a TCP dial of Address
+	Dial func(ctx context.Context) (net.Conn, error)
+	// DisableNotifications always polls for changes, even if the server has keyspace notifications enabled
+	DisableNotifications bool
+	// PollInterval is how often watched keys are re-read when polling.  It is also how long to wait before
+	// reconnecting a broken notification subscription.  Defaults to 10 seconds
+	PollInterval time.Duration
+	// Hooks report errors that happen in the background
+	Hooks distconf.Hooks
+
+	startOnce sync.Once
+	onClose   chan struct{}
+	wg        sync.WaitGroup
+
+	cmdMu   sync.Mutex
+	cmdConn *conn
+
+	mu         sync.Mutex
+	watches    map[string]func()
+	lastValues map[string][]byte
+	subConn    *conn
+}
+
+var _ distconf.Reader = &Reader{}
+var _ distconf.Watcher = &Reader{}
+var _ distconf.Shutdownable = &Reader{}
+
+func (r *Reader) onError(msg string, key string, err error) {
+	if r.Hooks.OnError != nil {
+		r.Hooks.OnError(msg, key, err)
+	}
+}
+
+func (r *Reader) pollInterval() time.Duration {
+	if r.PollInterval == 0 {
+		return time.Second * 10
+	}
+	return r.PollInterval
+}
+
+func (r *Reader) dial(ctx context.Context) (*conn, error) {
+	var netConn net.Conn
+	var err error
+	if r.Dial != nil {
+		netConn, err = r.Dial(ctx)
+	} else {
+		address := r.Address
+		if address == "" {
+			address = "localhost:6379"
+		}
+		var d net.Dialer
+		netConn, err = d.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := newConn(netConn)
+	if r.Password != "" {
+		if _, err := c.do(ctx, "AUTH", r.Password); err != nil {
+			return nil, closeWithError(c, err)
+		}
+	}
+	if r.DB != 0 {
+		if _, err := c.do(ctx, "SELECT", strconv.Itoa(r.DB)); err != nil {
+			return nil, closeWithError(c, err)
+		}
+	}
+	return c, nil
+}
+
+func closeWithError(c *conn, err error) error {
+	// The original error is more interesting than a close error
+	_ = c.Close()
+	return err
+}
+
+// do runs a single command on the shared command connection, reconnecting if the connection is broken
+func (r *Reader) do(ctx context.Context, args ...string) (interface{}, error) {
+	r.cmdMu.Lock()
+	defer r.cmdMu.Unlock()
+	if r.cmdConn == nil {
+		c, err := r.dial(ctx)
+		if err != nil {
+			return nil, err
+		}
+		r.cmdConn = c
+	}
+	reply, err := r.cmdConn.do(ctx, args...)
+	if err != nil {
+		if _, isRedisErr := err.(redisError); !isRedisErr {
+			if closeErr := r.cmdConn.Close(); closeErr != nil {
+				r.onError("unable to close broken connection", "", closeErr)
+			}
+			r.cmdConn = nil
+		}
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Read returns the string value of key, or the value of field key inside Hash if Hash is set
+func (r *Reader) Read(ctx context.Context, key string) ([]byte, error) {
+	var reply interface{}
+	var err error
+	if r.Hash != "" {
+		reply, err = r.do(ctx, "HGET", r.Hash, key)
+	} else {
+		reply, err = r.do(ctx, "GET", key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return asBytes(reply)
+}
+
+// Watch executes callback when key changes.  A nil callback removes the watch.
+func (r *Reader) Watch(ctx context.Context, key string, callback func()) error {
+	if callback == nil {
+		r.mu.Lock()
+		delete(r.watches, key)
+		delete(r.lastValues, key)
+		r.mu.Unlock()
+		return nil
+	}
+	r.start(ctx)
+	// Remember the current value so polling can tell when it changes
+	current, err := r.Read(ctx, key)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.watches == nil {
+		r.watches = make(map[string]func())
+		r.lastValues = make(map[string][]byte)
+	}
+	r.watches[key] = callback
+	if err == nil {
+		r.lastValues[key] = current
+	}
+	if r.subConn != nil && r.Hash == "" {
+		// The subscribe loop reads the reply
+		if subErr := r.subConn.writeCommand("SUBSCRIBE", r.channel(key)); subErr != nil {
+			r.onError("unable to subscribe to key", key, subErr)
+		}
+	}
+	return err
+}
+
+// Shutdown stops watching for changes and closes all connections
+func (r *Reader) Shutdown(ctx context.Context) error {
+	r.startOnce.Do(func() {
+		r.onClose = make(chan struct{})
+	})
+	r.mu.Lock()
+	select {
+	case <-r.onClose:
+	default:
+		close(r.onClose)
+	}
+	if r.subConn != nil {
+		if err := r.subConn.Close(); err != nil {
+			r.onError("unable to close subscription", "", err)
+		}
+	}
+	r.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	r.cmdMu.Lock()
+	defer r.cmdMu.Unlock()
+	if r.cmdConn != nil {
+		err := r.cmdConn.Close()
+		r.cmdConn = nil
+		return err
+	}
+	return nil
+}
+
+func (r *Reader) start(ctx context.Context) {
+	r.startOnce.Do(func() {
+		r.onClose = make(chan struct{})
+		r.wg.Add(1)
+		if !r.DisableNotifications && r.notificationsEnabled(ctx) {
+			go r.subscribeLoop()
+		} else {
+			go r.pollLoop()
+		}
+	})
+}
+
+// notificationsEnabled checks notify-keyspace-events for the events this reader needs
+func (r *Reader) notificationsEnabled(ctx context.Context) bool {
+	reply, err := r.do(ctx, "CONFIG", "GET", "notify-keyspace-events")
+	if err != nil {
+		r.onError("unable to check keyspace notifications.  Falling back to polling", "", err)
+		return false
+	}
+	parts, ok := reply.([]interface{})
+	if !ok || len(parts) != 2 {
+		return false
+	}
+	flags, err := asBytes(parts[1])
+	if err != nil {
+		return false
+	}
+	if !bytes.ContainsRune(flags, 'K') {
+		return false
+	}
+	if bytes.ContainsRune(flags, 'A') {
+		return true
+	}
+	typeFlag := '$'
+	if r.Hash != "" {
+		typeFlag = 'h'
+	}
+	return bytes.ContainsRune(flags, 'g') && bytes.ContainsRune(flags, typeFlag)
+}
+
+func (r *Reader) channelPrefix() string {
+	return "__keyspace@" + strconv.Itoa(r.DB) + "__:"
+}
+
+func (r *Reader) channel(key string) string {
+	return r.channelPrefix() + key
+}
+
+func (r *Reader) subscribeLoop() {
+	defer r.wg.Done()
+	for {
+		if err := r.subscribeOnce(); err != nil {
+			select {
+			case <-r.onClose:
+				return
+			default:
+			}
+			r.onError("redis subscription failed", "", err)
+		}
+		select {
+		case <-r.onClose:
+			return
+		case <-time.After(r.pollInterval()):
+		}
+	}
+}
+
+// subscribeOnce subscribes to every watched key and dispatches notifications until the connection breaks
+func (r *Reader) subscribeOnce() error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.pollInterval())
+	c, err := r.dial(ctx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	select {
+	case <-r.onClose:
+		r.mu.Unlock()
+		return c.Close()
+	default:
+	}
+	channels := []string{"SUBSCRIBE"}
+	if r.Hash != "" {
+		channels = append(channels, r.channel(r.Hash))
+	} else {
+		for key := range r.watches {
+			channels = append(channels, r.channel(key))
+		}
+	}
+	if len(channels) > 1 {
+		err = c.writeCommand(channels...)
+	}
+	if err == nil {
+		r.subConn = c
+	}
+	r.mu.Unlock()
+	if err != nil {
+		return closeWithError(c, err)
+	}
+	defer func() {
+		r.mu.Lock()
+		r.subConn = nil
+		r.mu.Unlock()
+		// Already broken, or closed by Shutdown
+		_ = c.Close()
+	}()
+	for {
+		reply, err := c.readReply()
+		if err != nil {
+			return err
+		}
+		r.dispatch(reply)
+	}
+}
+
+// dispatch executes callbacks for a keyspace notification.  Subscription confirmations also execute callbacks,
+// since the key could have changed while it was not subscribed.
+func (r *Reader) dispatch(reply interface{}) {
+	parts, ok := reply.([]interface{})
+	if !ok || len(parts) != 3 {
+		return
+	}
+	kind, err := asBytes(parts[0])
+	if err != nil || (string(kind) != "message" && string(kind) != "subscribe") {
+		return
+	}
+	channel, err := asBytes(parts[1])
+	if err != nil {
+		return
+	}
+	key := strings.TrimPrefix(string(channel), r.channelPrefix())
+	if r.Hash != "" {
+		if key == r.Hash {
+			r.triggerAll()
+		}
+		return
+	}
+	r.mu.Lock()
+	callback := r.watches[key]
+	r.mu.Unlock()
+	if callback != nil {
+		callback()
+	}
+}
+
+func (r *Reader) triggerAll() {
+	r.mu.Lock()
+	toCall := make([]func(), 0, len(r.watches))
+	for _, callback := range r.watches {
+		toCall = append(toCall, callback)
+	}
+	r.mu.Unlock()
+	for _, callback := range toCall {
+		callback()
+	}
+}
+
+func (r *Reader) pollLoop() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.pollInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.onClose:
+			return
+		case <-ticker.C:
+			r.poll()
+		}
+	}
+}
+
+// poll re-reads every watched key and executes the callbacks of the ones that changed
+func (r *Reader) poll() {
+	r.mu.Lock()
+	keys := make([]string, 0, len(r.watches))
+	for key := range r.watches {
+		keys = append(keys, key)
+	}
+	r.mu.Unlock()
+	for _, key := range keys {
+		ctx, cancel := context.WithTimeout(context.Background(), r.pollInterval())
+		current, err := r.Read(ctx, key)
+		cancel()
+		if err != nil {
+			r.onError("unable to poll key", key, err)
+			continue
+		}
+		r.mu.Lock()
+		previous, known := r.lastValues[key]
+		callback, watched := r.watches[key]
+		changed := watched && (!known || !bytes.Equal(previous, current) || (previous == nil) != (current == nil))
+		if watched {
+			r.lastValues[key] = current
+		}
+		r.mu.Unlock()
+		if changed {
+			callback()
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cep21/distconf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis is an in-process stand-in that speaks enough of the redis protocol for Reader
+type fakeRedis struct {
+	listener      net.Listener
+	password      string
+	notifyFlags   string
+	mu            sync.Mutex
+	strings       map[string]string
+	hashes        map[string]map[string]string
+	subscriptions map[string][]*conn
+	conns         []net.Conn
+	wg            sync.WaitGroup
+}
+
+func newFakeRedis(t *testing.T, notifyFlags string) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	f := &fakeRedis{
+		listener:      l,
+		notifyFlags:   notifyFlags,
+		strings:       make(map[string]string),
+		hashes:        make(map[string]map[string]string),
+		subscriptions: make(map[string][]*conn),
+	}
+	f.wg.Add(1)
+	go f.accept()
+	return f
+}
+
+func (f *fakeRedis) Close() {
+	_ = f.listener.Close()
+	f.mu.Lock()
+	for _, c := range f.conns {
+		_ = c.Close()
+	}
+	f.mu.Unlock()
+	f.wg.Wait()
+}
+
+func (f *fakeRedis) accept() {
+	defer f.wg.Done()
+	for {
+		c, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.conns = append(f.conns, c)
+		f.mu.Unlock()
+		f.wg.Add(1)
+		go f.serve(newConn(c))
+	}
+}
+
+func (f *fakeRedis) set(key string, value string) {
+	f.mu.Lock()
+	f.strings[key] = value
+	f.mu.Unlock()
+	f.notify(key, "set")
+}
+
+func (f *fakeRedis) hset(hash string, field string, value string) {
+	f.mu.Lock()
+	if f.hashes[hash] == nil {
+		f.hashes[hash] = make(map[string]string)
+	}
+	f.hashes[hash][field] = value
+	f.mu.Unlock()
+	f.notify(hash, "hset")
+}
+
+func (f *fakeRedis) notify(key string, event string) {
+	if !strings.Contains(f.notifyFlags, "K") {
+		return
+	}
+	channel := "__keyspace@0__:" + key
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.subscriptions[channel] {
+		_ = c.writeCommand("message", channel, event)
+	}
+}
+
+func (f *fakeRedis) serve(c *conn) {
+	defer f.wg.Done()
+	for {
+		reply, err := c.readReply()
+		if err != nil {
+			return
+		}
+		parts := reply.([]interface{})
+		args := make([]string, len(parts))
+		for i := range parts {
+			args[i] = string(parts[i].([]byte))
+		}
+		f.handle(c, args)
+	}
+}
+
+func (f *fakeRedis) write(c *conn, s string) {
+	_, _ = c.netConn.Write([]byte(s))
+}
+
+func bulk(s string) string {
+	return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n"
+}
+
+func (f *fakeRedis) handle(c *conn, args []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch strings.ToUpper(args[0]) {
+	case "AUTH":
+		if args[1] != f.password {
+			f.write(c, "-WRONGPASS invalid password\r\n")
+			return
+		}
+		f.write(c, "+OK\r\n")
+	case "GET":
+		if v, exists := f.strings[args[1]]; exists {
+			f.write(c, bulk(v))
+			return
+		}
+		f.write(c, "$-1\r\n")
+	case "HGET":
+		if v, exists := f.hashes[args[1]][args[2]]; exists {
+			f.write(c, bulk(v))
+			return
+		}
+		f.write(c, "$-1\r\n")
+	case "CONFIG":
+		f.write(c, "*2\r\n"+bulk("notify-keyspace-events")+bulk(f.notifyFlags))
+	case "SUBSCRIBE":
+		for i, channel := range args[1:] {
+			f.subscriptions[channel] = append(f.subscriptions[channel], c)
+			f.write(c, "*3\r\n"+bulk("subscribe")+bulk(channel)+":"+strconv.Itoa(i+1)+"\r\n")
+		}
+	default:
+		f.write(c, "-ERR unknown command\r\n")
+	}
+}
+
+func mustShutdown(t *testing.T, s distconf.Shutdownable) {
+	require.NoError(t, s.Shutdown(context.Background()))
+}
+
+func TestReader_Read(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeRedis(t, "")
+	f.password = "secret"
+	defer f.Close()
+	f.set("a", "1")
+	f.hset("flags", "b", "true")
+
+	r := &Reader{Address: f.listener.Addr().String(), Password: "secret"}
+	defer mustShutdown(t, r)
+	b, err := r.Read(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(b))
+	b, err = r.Read(ctx, "missing")
+	require.NoError(t, err)
+	assert.Nil(t, b)
+
+	h := &Reader{Address: f.listener.Addr().String(), Password: "secret", Hash: "flags"}
+	defer mustShutdown(t, h)
+	b, err = h.Read(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, "true", string(b))
+	b, err = h.Read(ctx, "a")
+	require.NoError(t, err)
+	assert.Nil(t, b)
+
+	bad := &Reader{Address: f.listener.Addr().String(), Password: "wrong"}
+	defer mustShutdown(t, bad)
+	_, err = bad.Read(ctx, "a")
+	assert.Error(t, err)
+}
+
+func testWatch(t *testing.T, notifyFlags string, hash string) {
+	ctx := context.Background()
+	f := newFakeRedis(t, notifyFlags)
+	defer f.Close()
+	write := f.set
+	if hash != "" {
+		write = func(key string, value string) {
+			f.hset(hash, key, value)
+		}
+	}
+	write("port", "80")
+
+	r := &Reader{
+		Address:      f.listener.Addr().String(),
+		Hash:         hash,
+		PollInterval: time.Millisecond,
+	}
+	d := &distconf.Distconf{
+		Readers: []distconf.Reader{r},
+	}
+	defer mustShutdown(t, r)
+	defer mustShutdown(t, d)
+
+	port := d.Int(ctx, "port", 0)
+	assert.Equal(t, int64(80), port.Get())
+	write("port", "8080")
+	require.Eventually(t, func() bool {
+		return port.Get() == 8080
+	}, time.Second, time.Millisecond)
+}
+
+func TestReader_Watch_notifications(t *testing.T) {
+	testWatch(t, "KA", "")
+}
+
+func TestReader_Watch_hashNotifications(t *testing.T) {
+	testWatch(t, "Kgh", "flags")
+}
+
+func TestReader_Watch_polling(t *testing.T) {
+	testWatch(t, "", "")
+}
+
+func TestReader_Watch_hashPolling(t *testing.T) {
+	testWatch(t, "Kg$", "flags")
+}
+
+func TestReader_Watch_remove(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeRedis(t, "")
+	defer f.Close()
+	r := &Reader{
+		Address:      f.listener.Addr().String(),
+		PollInterval: time.Millisecond,
+	}
+	defer mustShutdown(t, r)
+	called := make(chan struct{}, 10)
+	require.NoError(t, r.Watch(ctx, "a", func() {
+		called <- struct{}{}
+	}))
+	require.NoError(t, r.Watch(ctx, "a", nil))
+	f.set("a", "1")
+	time.Sleep(time.Millisecond * 20)
+	assert.Len(t, called, 0)
+}
+
+func TestReader_errors(t *testing.T) {
+	ctx := context.Background()
+	r := &Reader{
+		Dial: func(ctx context.Context) (net.Conn, error) {
+			return nil, &net.OpError{Op: "dial"}
+		},
+	}
+	defer mustShutdown(t, r)
+	_, err := r.Read(ctx, "a")
+	assert.Error(t, err)
+	assert.Error(t, r.Watch(ctx, "a", func() {}))
+}
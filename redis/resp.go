@@ -0,0 +1,143 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// redisError is an error reply sent by the server.  The connection is still usable after one.
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+var errProtocol = errors.New("redis protocol error")
+
+// conn is a minimal RESP connection: enough to run commands and receive pubsub messages
+type conn struct {
+	netConn net.Conn
+	reader  *bufio.Reader
+}
+
+func newConn(netConn net.Conn) *conn {
+	return &conn{
+		netConn: netConn,
+		reader:  bufio.NewReader(netConn),
+	}
+}
+
+func (c *conn) Close() error {
+	return c.netConn.Close()
+}
+
+// do sends a command and waits for its reply, respecting the deadline of ctx
+func (c *conn) do(ctx context.Context, args ...string) (interface{}, error) {
+	deadline, _ := ctx.Deadline()
+	if err := c.netConn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	defer func() {
+		// Best effort: the next command sets its own deadline
+		_ = c.netConn.SetDeadline(time.Time{})
+	}()
+	if err := c.writeCommand(args...); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+func (c *conn) writeCommand(args ...string) error {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	_, err := c.netConn.Write(buf)
+	return err
+}
+
+// readReply returns string for simple strings, []byte for bulk strings, int64 for integers, []interface{} for
+// arrays and nil for null replies.  Error replies are returned as a redisError.
+func (c *conn) readReply() (interface{}, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errProtocol
+	}
+	switch line[0] {
+	case '+':
+		return string(line[1:]), nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(string(line[1:]), 10, 64)
+	case '$':
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return nil, errProtocol
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return nil, err
+		}
+		return buf[:size], nil
+	case '*':
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return nil, errProtocol
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		ret := make([]interface{}, size)
+		for i := range ret {
+			if ret[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("%v: unexpected reply type %q", errProtocol, line[0])
+}
+
+func (c *conn) readLine() ([]byte, error) {
+	line, err := c.reader.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errProtocol
+	}
+	return line[:len(line)-2], nil
+}
+
+// asBytes converts a bulk or simple string reply into bytes
+func asBytes(reply interface{}) ([]byte, error) {
+	switch r := reply.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return r, nil
+	case string:
+		return []byte(r), nil
+	}
+	return nil, fmt.Errorf("%v: unexpected reply %v", errProtocol, reply)
+}
@@ -0,0 +1,129 @@
+package distconf
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultResyncConcurrency = 4
+
+// KeyErrors maps config keys to the error each of them had
+type KeyErrors map[string]error
+
+func (k KeyErrors) Error() string {
+	keys := make([]string, 0, len(k))
+	for key := range k {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	msgs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		msgs = append(msgs, key+": "+k[key].Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (c *Distconf) resyncConcurrency() int {
+	if c.ResyncConcurrency <= 0 {
+		return defaultResyncConcurrency
+	}
+	return c.ResyncConcurrency
+}
+
+// RefreshAll refreshes every registered key, ResyncConcurrency keys at a time.  Values update even if some Readers
+// fail.  The returned error is a KeyErrors of every key with a Reader that errored or with invalid bytes, or
+// the context error if ctx ended first.
+func (c *Distconf) RefreshAll(ctx context.Context) error {
+	c.varsMutex.Lock()
+	vars := make(map[string]*registeredVariableTracker, len(c.registeredVars))
+	for key, rv := range c.registeredVars {
+		vars[key] = rv
+	}
+	c.varsMutex.Unlock()
+
+	var mu sync.Mutex
+	errs := make(KeyErrors)
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, c.resyncConcurrency())
+	for key, rv := range vars {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		}
+		wg.Add(1)
+		go func(key string, rv *registeredVariableTracker) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := c.refresh(ctx, key, rv, preloadedKey{}); err != nil {
+				mu.Lock()
+				errs[key] = err
+				mu.Unlock()
+			}
+		}(key, rv)
+	}
+	wg.Wait()
+	for _, g := range c.allGroups() {
+		g.update()
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// StartResync calls RefreshAll about every interval until ctx ends or Distconf is shutdown, so values stay
+// correct even if a watch is missed or a Reader cannot Watch.  Each wait is randomly up to 10% shorter or longer
+// than interval, so many processes do not resync at the same time.  Errors are reported to Hooks.
+func (c *Distconf) StartResync(ctx context.Context, interval time.Duration) {
+	c.retryMutex.Lock()
+	defer c.retryMutex.Unlock()
+	if c.shutdown {
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c.resyncCancels = append(c.resyncCancels, cancel)
+	c.resyncs.Add(1)
+	go func() {
+		defer c.resyncs.Done()
+		defer cancel()
+		for {
+			timer := time.NewTimer(jitter(interval))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			// refresh already reports every error to Hooks
+			_ = c.RefreshAll(ctx)
+		}
+	}()
+}
+
+// stopResyncs ends every StartResync loop and waits for them to finish.  Used by Shutdown.
+func (c *Distconf) stopResyncs() {
+	c.retryMutex.Lock()
+	c.shutdown = true
+	cancels := c.resyncCancels
+	c.resyncCancels = nil
+	c.retryMutex.Unlock()
+	for _, cancel := range cancels {
+		cancel()
+	}
+	c.resyncs.Wait()
+}
+
+// jitter returns a random duration within 10% of interval
+func jitter(interval time.Duration) time.Duration {
+	spread := int64(interval / 5)
+	if spread <= 0 {
+		return interval
+	}
+	return interval - time.Duration(spread/2) + time.Duration(rand.Int63n(spread))
+}
@@ -0,0 +1,67 @@
+package distconf
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDistconf_RefreshAll(t *testing.T) {
+	ctx := context.Background()
+	primary := &flakyBacking{}
+	fallback := &plainBacking{}
+	require.NoError(t, primary.Write(ctx, "port", []byte("8080")))
+	require.NoError(t, fallback.m.Write(ctx, "host", []byte("a.com")))
+	conf := &Distconf{Readers: []Reader{primary, fallback}, ResyncConcurrency: 1}
+	defer mustShutdown(t, conf)
+	port := conf.Int(ctx, "port", 0)
+	host := conf.Str(ctx, "host", "")
+
+	// fallback is not a Watcher, so only a refresh notices
+	require.NoError(t, fallback.m.Write(ctx, "host", []byte("b.com")))
+	assert.Equal(t, "a.com", host.Get())
+	require.NoError(t, conf.RefreshAll(ctx))
+	assert.Equal(t, "b.com", host.Get())
+
+	primary.setBroken(true)
+	err := conf.RefreshAll(ctx)
+	assert.Equal(t, KeyErrors{"host": errNope, "port": errNope}, err)
+	assert.Equal(t, "host: nope; port: nope", err.Error())
+	assert.Equal(t, int64(0), port.Get())
+
+	// Refreshes do not register the same watch twice
+	conf.registeredWatchesMutex.Lock()
+	assert.Len(t, conf.registeredWatches["port"], 1)
+	conf.registeredWatchesMutex.Unlock()
+}
+
+func TestDistconf_StartResync(t *testing.T) {
+	ctx := context.Background()
+	backing := &plainBacking{}
+	conf := &Distconf{Readers: []Reader{backing}}
+	host := conf.Str(ctx, "host", "")
+	conf.StartResync(ctx, time.Millisecond)
+
+	require.NoError(t, backing.m.Write(ctx, "host", []byte("a.com")))
+	require.Eventually(t, func() bool {
+		return host.Get() == "a.com"
+	}, time.Second, time.Millisecond)
+
+	// Shutdown stops resyncing
+	mustShutdown(t, conf)
+	conf.StartResync(ctx, time.Millisecond)
+	require.NoError(t, backing.m.Write(ctx, "host", []byte("b.com")))
+	time.Sleep(time.Millisecond * 20)
+	assert.Equal(t, "a.com", host.Get())
+}
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		j := jitter(time.Second)
+		assert.True(t, j >= time.Millisecond*900 && j < time.Millisecond*1100, j)
+	}
+	assert.Equal(t, time.Duration(1), jitter(1))
+}
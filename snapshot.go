@@ -0,0 +1,248 @@
+package distconf
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SnapshotCache wraps a Reader and saves every value it successfully reads to a local file.  When the wrapped
+// Reader returns an error, the last known good value is served from that file instead, so a process that starts
+// while its backend is down still boots with the right config.  Versions of a VersionedReader are saved with their
+// value, and ReadMany uses the ReadMany of a BatchReader.  Watcher, Subscriber and Shutdownable are forwarded to
+// the wrapped Reader.  Reads are saved together at most once every SaveInterval.  Call Flush or Shutdown before
+// exiting to save any that are left.  All public functions are thread safe.
+type SnapshotCache struct {
+	// Reader is the wrapped backend
+	Reader Reader
+	// Path of the snapshot file
+	Path string
+	// Hooks report when values are served from the snapshot, and errors saving it
+	Hooks Hooks
+	// Now defaults to time.Now
+	Now func() time.Time
+	// SaveInterval is how long successful reads wait to be saved, so reads close together are saved with a single
+	// write of the file.  Defaults to 1 second
+	SaveInterval time.Duration
+
+	loadOnce sync.Once
+	// saveMu is held while the file is written, so writes are never reordered
+	saveMu  sync.Mutex
+	mu      sync.Mutex
+	entries map[string]snapshotEntry
+	// dirty is true if entries changed since they were last saved
+	dirty bool
+	// saveTimer is the pending save, or nil if there is none
+	saveTimer *time.Timer
+}
+
+// snapshotEntry is a single value inside the snapshot file
+type snapshotEntry struct {
+	Value   []byte `json:"value"`
+	Version int64  `json:"version,omitempty"`
+	// ReadAt is the last time the value was successfully read, even if it did not change
+	ReadAt time.Time `json:"read_at"`
+}
+
+var _ Reader = &SnapshotCache{}
+var _ VersionedReader = &SnapshotCache{}
+var _ BatchReader = &SnapshotCache{}
+var _ Watcher = &SnapshotCache{}
+var _ Subscriber = &SnapshotCache{}
+var _ Shutdownable = &SnapshotCache{}
+
+func (s *SnapshotCache) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
+	}
+	return s.Now()
+}
+
+func (s *SnapshotCache) saveInterval() time.Duration {
+	if s.SaveInterval == 0 {
+		return time.Second
+	}
+	return s.SaveInterval
+}
+
+func (s *SnapshotCache) load() {
+	s.loadOnce.Do(func() {
+		s.entries = make(map[string]snapshotEntry)
+		b, err := ioutil.ReadFile(s.Path)
+		if os.IsNotExist(err) {
+			return
+		}
+		if err != nil {
+			s.Hooks.onError("unable to read snapshot", "", err)
+			return
+		}
+		if err := json.Unmarshal(b, &s.entries); err != nil {
+			s.Hooks.onError("unable to decode snapshot", "", err)
+			s.entries = make(map[string]snapshotEntry)
+		}
+	})
+}
+
+func (s *SnapshotCache) wrapped() Reader {
+	return s.Reader
+}
+
+// Read key from the wrapped Reader, falling back to the snapshot if it returns an error
+func (s *SnapshotCache) Read(ctx context.Context, key string) ([]byte, error) {
+	value, _, err := s.ReadVersioned(ctx, key)
+	return value, err
+}
+
+// ReadVersioned reads key like Read, with the version of the wrapped Reader if it is a VersionedReader
+func (s *SnapshotCache) ReadVersioned(ctx context.Context, key string) ([]byte, int64, error) {
+	s.load()
+	b, version, err := readVersioned(ctx, s.Reader, key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		entry, exists := s.entries[key]
+		if !exists {
+			return nil, 0, err
+		}
+		s.Hooks.onSnapshotServe(key, s.now().Sub(entry.ReadAt))
+		return entry.Value, entry.Version, nil
+	}
+	s.record(key, b, version)
+	return b, version, nil
+}
+
+// ReadMany reads keys from the wrapped Reader, with a single ReadMany if it is a BatchReader.  If it returns an
+// error and every key is in the snapshot, the snapshot is served instead.
+func (s *SnapshotCache) ReadMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	s.load()
+	values, err := readMany(ctx, s.Reader, keys)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		for _, key := range keys {
+			if _, exists := s.entries[key]; !exists {
+				return nil, err
+			}
+		}
+		ret := make(map[string][]byte, len(keys))
+		for _, key := range keys {
+			entry := s.entries[key]
+			s.Hooks.onSnapshotServe(key, s.now().Sub(entry.ReadAt))
+			ret[key] = entry.Value
+		}
+		return ret, nil
+	}
+	for _, key := range keys {
+		s.record(key, values[key], 0)
+	}
+	return values, nil
+}
+
+// record stores a successful read of key, and schedules a save if the snapshot changed.  Must hold s.mu.
+func (s *SnapshotCache) record(key string, b []byte, version int64) {
+	_, exists := s.entries[key]
+	if b == nil {
+		if !exists {
+			return
+		}
+		delete(s.entries, key)
+	} else {
+		s.entries[key] = snapshotEntry{
+			Value:   b,
+			Version: version,
+			ReadAt:  s.now(),
+		}
+	}
+	s.dirty = true
+	if s.saveTimer == nil {
+		s.saveTimer = time.AfterFunc(s.saveInterval(), s.Flush)
+	}
+}
+
+// Age returns how long ago the snapshot value of key was last successfully read, and false if key is not in the
+// snapshot
+func (s *SnapshotCache) Age(key string) (time.Duration, bool) {
+	s.load()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, exists := s.entries[key]
+	if !exists {
+		return 0, false
+	}
+	return s.now().Sub(entry.ReadAt), true
+}
+
+// Flush saves reads that are waiting for SaveInterval now
+func (s *SnapshotCache) Flush() {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	s.mu.Lock()
+	if s.saveTimer != nil {
+		s.saveTimer.Stop()
+		s.saveTimer = nil
+	}
+	if !s.dirty {
+		s.mu.Unlock()
+		return
+	}
+	s.dirty = false
+	b, err := json.Marshal(s.entries)
+	s.mu.Unlock()
+	if err != nil {
+		s.Hooks.onError("unable to encode snapshot", "", err)
+		return
+	}
+	s.save(b)
+}
+
+// save writes b to Path.  The file is synced and replaced atomically, so a crash never leaves a partial snapshot.
+// Must hold s.saveMu.
+func (s *SnapshotCache) save(b []byte) {
+	f, err := ioutil.TempFile(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp")
+	if err != nil {
+		s.Hooks.onError("unable to create snapshot", "", err)
+		return
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.Path)
+	}
+	if err != nil {
+		s.Hooks.onError("unable to write snapshot", "", err)
+		if removeErr := os.Remove(f.Name()); removeErr != nil && !os.IsNotExist(removeErr) {
+			s.Hooks.onError("unable to remove temporary snapshot", "", removeErr)
+		}
+	}
+}
+
+// Watch forwards to the wrapped Reader if it is a Watcher
+func (s *SnapshotCache) Watch(ctx context.Context, key string, callback func()) error {
+	if w, ok := s.Reader.(Watcher); ok {
+		return w.Watch(ctx, key, callback)
+	}
+	return nil
+}
+
+// Subscribe forwards to the wrapped Reader if it is a Subscriber
+func (s *SnapshotCache) Subscribe(key string, callback func()) func() {
+	return subscribe(s.Reader, key, callback)
+}
+
+// Shutdown saves reads that are waiting for SaveInterval, and forwards to the wrapped Reader if it is Shutdownable
+func (s *SnapshotCache) Shutdown(ctx context.Context) error {
+	s.Flush()
+	if sh, ok := s.Reader.(Shutdownable); ok {
+		return sh.Shutdown(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package distconf
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyBacking returns errNope for every call while broken is set
+type flakyBacking struct {
+	Mem
+	broken int32
+}
+
+func (f *flakyBacking) setBroken(broken bool) {
+	var val int32
+	if broken {
+		val = 1
+	}
+	atomic.StoreInt32(&f.broken, val)
+}
+
+func (f *flakyBacking) Read(ctx context.Context, key string) ([]byte, error) {
+	if atomic.LoadInt32(&f.broken) != 0 {
+		return nil, errNope
+	}
+	return f.Mem.Read(ctx, key)
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "distconf")
+	require.NoError(t, err)
+	return dir, func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}
+}
+
+func TestSnapshotCache(t *testing.T) {
+	ctx := context.Background()
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "snapshot.json")
+	now := time.Unix(1000, 0)
+	backing := &flakyBacking{}
+	require.NoError(t, backing.Write(ctx, "port", []byte("8080")))
+	require.NoError(t, backing.Write(ctx, "host", []byte("a.com")))
+
+	s := &SnapshotCache{
+		Reader: backing,
+		Path:   path,
+		Now: func() time.Time {
+			return now
+		},
+	}
+	conf := &Distconf{Readers: []Reader{s}}
+	assert.Equal(t, int64(8080), conf.Int(ctx, "port", 1).Get())
+	assert.Equal(t, "a.com", conf.Str(ctx, "host", "").Get())
+	// Watches are forwarded
+	require.NoError(t, backing.Write(ctx, "host", nil))
+	assert.Equal(t, "", conf.Str(ctx, "host", "").Get())
+	mustShutdown(t, conf)
+	require.NoError(t, s.Shutdown(ctx))
+
+	// A new process starts while the backend is down
+	backing.setBroken(true)
+	now = now.Add(time.Minute)
+	var served []string
+	var servedAge time.Duration
+	s = &SnapshotCache{
+		Reader: backing,
+		Path:   path,
+		Hooks: Hooks{
+			OnSnapshotServe: func(distconfKey string, age time.Duration) {
+				served = append(served, distconfKey)
+				servedAge = age
+			},
+		},
+		Now: func() time.Time {
+			return now
+		},
+	}
+	conf = &Distconf{Readers: []Reader{s}}
+	defer mustShutdown(t, conf)
+	assert.Equal(t, int64(8080), conf.Int(ctx, "port", 1).Get())
+	assert.Equal(t, "default", conf.Str(ctx, "host", "default").Get())
+	assert.Equal(t, []string{"port"}, served)
+	assert.Equal(t, time.Minute, servedAge)
+	age, exists := s.Age("port")
+	assert.True(t, exists)
+	assert.Equal(t, time.Minute, age)
+	_, exists = s.Age("host")
+	assert.False(t, exists)
+}
+
+func TestSnapshotCache_errors(t *testing.T) {
+	ctx := context.Background()
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	errCount := 0
+	hooks := Hooks{
+		OnError: func(msg string, distconfKey string, err error) {
+			errCount++
+		},
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.json")
+	require.NoError(t, ioutil.WriteFile(corrupt, []byte("not json"), 0600))
+	s := &SnapshotCache{Reader: &allErrorBacking{}, Path: corrupt, Hooks: hooks}
+	_, err := s.Read(ctx, "port")
+	assert.Equal(t, errNope, err)
+	assert.Equal(t, 1, errCount)
+	assert.Error(t, s.Watch(ctx, "port", func() {}))
+	assert.NoError(t, s.Shutdown(ctx))
+
+	m := &Mem{}
+	require.NoError(t, m.Write(ctx, "port", []byte("1")))
+	s = &SnapshotCache{Reader: m, Path: filepath.Join(dir, "missing", "snapshot.json"), Hooks: hooks}
+	b, err := s.Read(ctx, "port")
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(b))
+	s.Flush()
+	assert.Equal(t, 2, errCount)
+}
+
+func TestSnapshotCache_save(t *testing.T) {
+	ctx := context.Background()
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "snapshot.json")
+	now := time.Unix(1000, 0)
+	backing := &flakyBacking{}
+	require.NoError(t, backing.Write(ctx, "port", []byte("8080")))
+	s := &SnapshotCache{
+		Reader:       backing,
+		Path:         path,
+		SaveInterval: time.Hour,
+		Now: func() time.Time {
+			return now
+		},
+	}
+
+	// Reads wait for SaveInterval, or Flush
+	_, err := s.Read(ctx, "port")
+	require.NoError(t, err)
+	_, err = s.ReadMany(ctx, []string{"port", "missing"})
+	require.NoError(t, err)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	s.Flush()
+	_, err = os.Stat(path)
+	require.NoError(t, err)
+
+	// A read of a value that did not change still saves when it was read
+	now = now.Add(time.Minute)
+	_, err = s.Read(ctx, "port")
+	require.NoError(t, err)
+	s.Flush()
+	backing.setBroken(true)
+	now = now.Add(time.Second)
+	s = &SnapshotCache{
+		Reader: backing,
+		Path:   path,
+		Now: func() time.Time {
+			return now
+		},
+	}
+	_, err = s.Read(ctx, "port")
+	require.NoError(t, err)
+	age, exists := s.Age("port")
+	assert.True(t, exists)
+	assert.Equal(t, time.Second, age)
+
+	// Without Flush, reads are saved after SaveInterval
+	require.NoError(t, os.Remove(path))
+	backing.setBroken(false)
+	s = &SnapshotCache{Reader: backing, Path: path, SaveInterval: time.Millisecond}
+	_, err = s.Read(ctx, "port")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,12 @@
+module github.com/cep21/distconf/sqlreader
+
+go 1.12
+
+require (
+	github.com/cep21/distconf v0.1.0
+	github.com/mattn/go-sqlite3 v1.11.0
+	github.com/stretchr/testify v1.6.1
+)
+
+// Builds inside this repository use the local distconf.  Users of this module get the version required above.
+replace github.com/cep21/distconf => ../
@@ -0,0 +1,244 @@
+// Package sqlreader allows distconf to read configuration from a key/value table inside a SQL database.
+package sqlreader
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cep21/distconf"
+)
+
+// Reader serves distconf keys from a table of key/value rows.  Watched keys are detected by polling a version
+// column, such as an updated_at timestamp, of every watched key in a single query.  Table and column names are
+// put into queries as is, so they must be trusted.  All public functions are thread safe.
+type Reader struct {
+	// DB is the database to query
+	DB *sql.DB
+	// Table that holds the configuration.  Defaults to "distconf"
+	Table string
+	// KeyColumn holds the distconf key.  Defaults to "key"
+	KeyColumn string
+	// ValueColumn holds the value.  A NULL value is treated as a missing key.  Defaults to "value"
+	ValueColumn string
+	// VersionColumn changes every time a row changes.  Defaults to "updated_at"
+	VersionColumn string
+	// Placeholder returns the bind parameter for the n-th argument, starting at 1.  Defaults to the $1 style
+	// that postgres uses.
+	Placeholder func(n int) string
+	// PollInterval is how often the version of watched keys is checked.  Defaults to 10 seconds
+	PollInterval time.Duration
+	// Hooks report errors that happen in the background
+	Hooks distconf.Hooks
+
+	startOnce sync.Once
+	onClose   chan struct{}
+	wg        sync.WaitGroup
+
+	mu       sync.Mutex
+	watches  map[string]func()
+	versions map[string]string
+}
+
+var _ distconf.Reader = &Reader{}
+var _ distconf.Watcher = &Reader{}
+var _ distconf.Shutdownable = &Reader{}
+
+// QuestionPlaceholder is a Placeholder for databases that use ? as bind parameters, like MySQL
+func QuestionPlaceholder(int) string {
+	return "?"
+}
+
+func (r *Reader) onError(msg string, key string, err error) {
+	if r.Hooks.OnError != nil {
+		r.Hooks.OnError(msg, key, err)
+	}
+}
+
+func orDefault(s string, defaultVal string) string {
+	if s == "" {
+		return defaultVal
+	}
+	return s
+}
+
+func (r *Reader) placeholder(n int) string {
+	if r.Placeholder == nil {
+		return "$" + strconv.Itoa(n)
+	}
+	return r.Placeholder(n)
+}
+
+func (r *Reader) pollInterval() time.Duration {
+	if r.PollInterval == 0 {
+		return time.Second * 10
+	}
+	return r.PollInterval
+}
+
+// Read returns the value column of the row for key
+func (r *Reader) Read(ctx context.Context, key string) ([]byte, error) {
+	query := "SELECT " + orDefault(r.ValueColumn, "value") +
+		" FROM " + orDefault(r.Table, "distconf") +
+		" WHERE " + orDefault(r.KeyColumn, "key") + " = " + r.placeholder(1)
+	var value []byte
+	err := r.DB.QueryRowContext(ctx, query, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// versionsOf returns the current version of each key that has a row
+func (r *Reader) versionsOf(ctx context.Context, keys []string) (map[string]string, error) {
+	placeholders := make([]string, len(keys))
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		placeholders[i] = r.placeholder(i + 1)
+		args[i] = key
+	}
+	keyColumn := orDefault(r.KeyColumn, "key")
+	query := "SELECT " + keyColumn + ", " + orDefault(r.VersionColumn, "updated_at") +
+		" FROM " + orDefault(r.Table, "distconf") +
+		" WHERE " + keyColumn + " IN (" + strings.Join(placeholders, ", ") + ")"
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			r.onError("unable to close rows", "", err)
+		}
+	}()
+	ret := make(map[string]string, len(keys))
+	for rows.Next() {
+		var key string
+		var version sql.NullString
+		if err := rows.Scan(&key, &version); err != nil {
+			return nil, err
+		}
+		ret[key] = version.String
+	}
+	return ret, rows.Err()
+}
+
+// Watch executes callback when the version of key changes, or its row is added or removed.  A nil callback
+// removes the watch.
+func (r *Reader) Watch(ctx context.Context, key string, callback func()) error {
+	if callback == nil {
+		r.mu.Lock()
+		delete(r.watches, key)
+		delete(r.versions, key)
+		r.mu.Unlock()
+		return nil
+	}
+	r.start()
+	versions, err := r.versionsOf(ctx, []string{key})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.watches == nil {
+		r.watches = make(map[string]func())
+		r.versions = make(map[string]string)
+	}
+	r.watches[key] = callback
+	if err == nil {
+		r.recordVersion(key, versions)
+	}
+	return err
+}
+
+// recordVersion stores the version of key inside versions, returning true if it is different than before.
+// Must hold r.mu.
+func (r *Reader) recordVersion(key string, versions map[string]string) bool {
+	previous, hadPrevious := r.versions[key]
+	current, hasCurrent := versions[key]
+	if hasCurrent {
+		r.versions[key] = current
+	} else {
+		delete(r.versions, key)
+	}
+	return hadPrevious != hasCurrent || previous != current
+}
+
+func (r *Reader) start() {
+	r.startOnce.Do(func() {
+		r.onClose = make(chan struct{})
+		r.wg.Add(1)
+		go r.pollLoop()
+	})
+}
+
+// Shutdown stops polling for changes.  It does not close DB.
+func (r *Reader) Shutdown(ctx context.Context) error {
+	r.start()
+	r.mu.Lock()
+	select {
+	case <-r.onClose:
+	default:
+		close(r.onClose)
+	}
+	r.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Reader) pollLoop() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.pollInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.onClose:
+			return
+		case <-ticker.C:
+			r.poll()
+		}
+	}
+}
+
+// poll fetches the version of every watched key in one query and executes callbacks for the ones that changed
+func (r *Reader) poll() {
+	r.mu.Lock()
+	keys := make([]string, 0, len(r.watches))
+	for key := range r.watches {
+		keys = append(keys, key)
+	}
+	r.mu.Unlock()
+	if len(keys) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.pollInterval())
+	versions, err := r.versionsOf(ctx, keys)
+	cancel()
+	if err != nil {
+		r.onError("unable to poll versions", "", err)
+		return
+	}
+	var toCall []func()
+	r.mu.Lock()
+	for _, key := range keys {
+		callback, watched := r.watches[key]
+		if watched && r.recordVersion(key, versions) {
+			toCall = append(toCall, callback)
+		}
+	}
+	r.mu.Unlock()
+	for _, callback := range toCall {
+		callback()
+	}
+}
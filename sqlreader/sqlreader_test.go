@@ -0,0 +1,138 @@
+package sqlreader
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cep21/distconf"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustShutdown(t *testing.T, s distconf.Shutdownable) {
+	require.NoError(t, s.Shutdown(context.Background()))
+}
+
+func makeDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	// Every connection to :memory: is a different database
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec("CREATE TABLE config (name TEXT PRIMARY KEY, val TEXT, version INTEGER NOT NULL)")
+	require.NoError(t, err)
+	return db
+}
+
+func upsert(t *testing.T, db *sql.DB, key string, value interface{}) {
+	_, err := db.Exec("INSERT INTO config (name, val, version) VALUES (?, ?, 1) "+
+		"ON CONFLICT(name) DO UPDATE SET val = excluded.val, version = version + 1", key, value)
+	require.NoError(t, err)
+}
+
+func makeReader(db *sql.DB) *Reader {
+	return &Reader{
+		DB:            db,
+		Table:         "config",
+		KeyColumn:     "name",
+		ValueColumn:   "val",
+		VersionColumn: "version",
+		PollInterval:  time.Millisecond,
+	}
+}
+
+func TestReader_Read(t *testing.T) {
+	ctx := context.Background()
+	db := makeDB(t)
+	defer func() {
+		require.NoError(t, db.Close())
+	}()
+	upsert(t, db, "a", "1")
+	upsert(t, db, "null", nil)
+	r := makeReader(db)
+	defer mustShutdown(t, r)
+
+	b, err := r.Read(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(b))
+	for _, key := range []string{"null", "missing"} {
+		b, err = r.Read(ctx, key)
+		require.NoError(t, err)
+		assert.Nil(t, b, key)
+	}
+
+	r.Placeholder = QuestionPlaceholder
+	b, err = r.Read(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(b))
+
+	r.Table = "not_a_table"
+	_, err = r.Read(ctx, "a")
+	assert.Error(t, err)
+}
+
+func TestReader_Watch(t *testing.T) {
+	ctx := context.Background()
+	db := makeDB(t)
+	defer func() {
+		require.NoError(t, db.Close())
+	}()
+	upsert(t, db, "port", "80")
+	r := makeReader(db)
+	d := &distconf.Distconf{
+		Readers: []distconf.Reader{r},
+	}
+	defer mustShutdown(t, r)
+	defer mustShutdown(t, d)
+
+	port := d.Int(ctx, "port", 1)
+	host := d.Str(ctx, "host", "localhost")
+	assert.Equal(t, int64(80), port.Get())
+
+	upsert(t, db, "port", "8080")
+	upsert(t, db, "host", "example.com")
+	require.Eventually(t, func() bool {
+		return port.Get() == 8080 && host.Get() == "example.com"
+	}, time.Second, time.Millisecond)
+
+	_, err := db.Exec("DELETE FROM config WHERE name = ?", "port")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return port.Get() == 1
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, r.Watch(ctx, "host", nil))
+	upsert(t, db, "host", "ignored.com")
+	time.Sleep(time.Millisecond * 20)
+	assert.Equal(t, "example.com", host.Get())
+}
+
+func TestReader_pollErrors(t *testing.T) {
+	ctx := context.Background()
+	db := makeDB(t)
+	defer func() {
+		require.NoError(t, db.Close())
+	}()
+	errs := make(chan error, 100)
+	r := makeReader(db)
+	r.Hooks.OnError = func(msg string, distconfKey string, err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+	defer mustShutdown(t, r)
+	require.NoError(t, r.Watch(ctx, "a", func() {}))
+	_, err := db.Exec("DROP TABLE config")
+	require.NoError(t, err)
+	select {
+	case err := <-errs:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		require.NoError(t, errors.New("expected a poll error"))
+	}
+	assert.Error(t, r.Watch(ctx, "b", func() {}))
+}
@@ -0,0 +1,151 @@
+package distconf
+
+import (
+	"sync"
+	"time"
+)
+
+// ErrorMode controls what happens to a variable when a Reader returns an error while refreshing it
+type ErrorMode int
+
+const (
+	// ErrorModeDefault uses the ErrorMode of Distconf.  On Distconf itself, it is ErrorFallThrough.
+	ErrorModeDefault ErrorMode = iota
+	// ErrorFallThrough skips a Reader that errors and uses the value of the next Reader, or the default
+	ErrorFallThrough
+	// ErrorSticky keeps the current value when a Reader errors and retries the refresh with backoff.  If the
+	// Reader is still failing after the grace period, the refresh falls through like ErrorFallThrough and keeps
+	// retrying until the Reader recovers.  The first read of a key always falls through, so startup never blocks
+	// on a broken Reader.
+	ErrorSticky
+)
+
+const (
+	defaultErrorGracePeriod   = time.Minute
+	defaultErrorRetryInterval = time.Second
+	maxErrorRetryInterval     = time.Minute
+)
+
+// errorState tracks Reader errors for a single ErrorSticky variable
+type errorState struct {
+	mu          sync.Mutex
+	initialized bool
+	// firstError is when the current run of errors started.  Zero if the last refresh had no errors
+	firstError time.Time
+	attempts   uint
+	retryTimer *time.Timer
+}
+
+func (c *Distconf) now() time.Time {
+	if c.nowFunc == nil {
+		return time.Now()
+	}
+	return c.nowFunc()
+}
+
+func (c *Distconf) errorMode(rv *registeredVariableTracker) ErrorMode {
+	if rv.options.errorMode != ErrorModeDefault {
+		return rv.options.errorMode
+	}
+	if c.ErrorMode != ErrorModeDefault {
+		return c.ErrorMode
+	}
+	return ErrorFallThrough
+}
+
+func (c *Distconf) errorGracePeriod(rv *registeredVariableTracker) time.Duration {
+	if rv.options.errorGracePeriod != 0 {
+		return rv.options.errorGracePeriod
+	}
+	if c.ErrorGracePeriod != 0 {
+		return c.ErrorGracePeriod
+	}
+	return defaultErrorGracePeriod
+}
+
+// holdOnError is called when a Reader errors while refreshing key.  It returns true if the current value should
+// be kept instead of falling through to the next Reader.
+func (c *Distconf) holdOnError(rv *registeredVariableTracker) bool {
+	if c.errorMode(rv) != ErrorSticky {
+		return false
+	}
+	state := &rv.errors
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if !state.initialized {
+		return false
+	}
+	now := c.now()
+	if state.firstError.IsZero() {
+		state.firstError = now
+	}
+	return now.Sub(state.firstError) < c.errorGracePeriod(rv)
+}
+
+// refreshDone is called after a refresh of key finishes.  hadError is true if any Reader errored.
+func (c *Distconf) refreshDone(key string, rv *registeredVariableTracker, hadError bool) {
+	state := &rv.errors
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.initialized = true
+	if !hadError {
+		state.firstError = time.Time{}
+		state.attempts = 0
+		if state.retryTimer != nil {
+			state.retryTimer.Stop()
+			state.retryTimer = nil
+		}
+		return
+	}
+	if c.errorMode(rv) == ErrorSticky {
+		// Retry until the Reader recovers, even after falling through
+		if state.firstError.IsZero() {
+			state.firstError = c.now()
+		}
+		c.scheduleRetry(key, state)
+	}
+}
+
+// scheduleRetry refreshes key again after an exponential backoff.  Must hold state.mu.
+func (c *Distconf) scheduleRetry(key string, state *errorState) {
+	if state.retryTimer != nil {
+		return
+	}
+	c.retryMutex.Lock()
+	defer c.retryMutex.Unlock()
+	if c.shutdown {
+		return
+	}
+	interval := c.ErrorRetryInterval
+	if interval == 0 {
+		interval = defaultErrorRetryInterval
+	}
+	for i := uint(0); i < state.attempts && interval < maxErrorRetryInterval; i++ {
+		interval *= 2
+	}
+	if interval > maxErrorRetryInterval {
+		interval = maxErrorRetryInterval
+	}
+	state.attempts++
+	state.retryTimer = time.AfterFunc(interval, func() {
+		state.mu.Lock()
+		state.retryTimer = nil
+		state.mu.Unlock()
+		c.watchCallback(key)()
+	})
+}
+
+// stopRetries cancels every pending retry and prevents new ones.  Used by Shutdown.
+func (c *Distconf) stopRetries() {
+	c.retryMutex.Lock()
+	c.shutdown = true
+	c.retryMutex.Unlock()
+	for _, rv := range c.registeredVars {
+		rv.errors.mu.Lock()
+		if rv.errors.retryTimer != nil {
+			rv.errors.retryTimer.Stop()
+			rv.errors.retryTimer = nil
+		}
+		rv.errors.mu.Unlock()
+	}
+}
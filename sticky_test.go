@@ -0,0 +1,105 @@
+package distconf
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeStickyConf(t *testing.T) (*flakyBacking, *Mem, *Distconf, func(time.Duration)) {
+	ctx := context.Background()
+	primary := &flakyBacking{}
+	fallback := &Mem{}
+	require.NoError(t, primary.Write(ctx, "port", []byte("8080")))
+	require.NoError(t, fallback.Write(ctx, "port", []byte("1")))
+	require.NoError(t, primary.Write(ctx, "host", []byte("a.com")))
+	require.NoError(t, fallback.Write(ctx, "host", []byte("b.com")))
+	now := time.Now().UnixNano()
+	conf := &Distconf{
+		Readers:            []Reader{primary, fallback},
+		ErrorGracePeriod:   time.Minute,
+		ErrorRetryInterval: time.Millisecond,
+		nowFunc: func() time.Time {
+			return time.Unix(0, atomic.LoadInt64(&now))
+		},
+	}
+	advance := func(d time.Duration) {
+		atomic.AddInt64(&now, int64(d))
+	}
+	return primary, fallback, conf, advance
+}
+
+func TestDistconf_ErrorSticky(t *testing.T) {
+	ctx := context.Background()
+	primary, _, conf, advance := makeStickyConf(t)
+	conf.ErrorMode = ErrorSticky
+	defer mustShutdown(t, conf)
+
+	port := conf.Int(ctx, "port", 0)
+	host := conf.Str(ctx, "host", "", WithErrorMode(ErrorFallThrough))
+	assert.Equal(t, int64(8080), port.Get())
+	assert.Equal(t, "a.com", host.Get())
+
+	primary.setBroken(true)
+	conf.Refresh(ctx, "port")
+	conf.Refresh(ctx, "host")
+	assert.Equal(t, int64(8080), port.Get())
+	assert.Equal(t, "b.com", host.Get())
+
+	// After the grace period the value falls through
+	advance(time.Minute * 2)
+	conf.Refresh(ctx, "port")
+	assert.Equal(t, int64(1), port.Get())
+
+	// Retries notice the primary has recovered
+	primary.setBroken(false)
+	require.Eventually(t, func() bool {
+		return port.Get() == 8080
+	}, time.Second, time.Millisecond)
+}
+
+func TestDistconf_ErrorSticky_perKey(t *testing.T) {
+	ctx := context.Background()
+	primary, _, conf, advance := makeStickyConf(t)
+	defer mustShutdown(t, conf)
+
+	port := conf.Int(ctx, "port", 0, WithErrorMode(ErrorSticky), WithErrorGracePeriod(time.Hour))
+	host := conf.Str(ctx, "host", "")
+
+	primary.setBroken(true)
+	advance(time.Minute * 2)
+	conf.Refresh(ctx, "port")
+	conf.Refresh(ctx, "host")
+	assert.Equal(t, int64(8080), port.Get())
+	assert.Equal(t, "b.com", host.Get())
+
+	// Watches update the value again once the primary recovers
+	primary.setBroken(false)
+	require.NoError(t, primary.Write(ctx, "port", []byte("9090")))
+	assert.Equal(t, int64(9090), port.Get())
+}
+
+func TestDistconf_ErrorSticky_startup(t *testing.T) {
+	ctx := context.Background()
+	primary, _, conf, _ := makeStickyConf(t)
+	conf.ErrorMode = ErrorSticky
+	primary.setBroken(true)
+
+	// The first read falls through, then retries until the primary recovers
+	port := conf.Int(ctx, "port", 0)
+	assert.Equal(t, int64(1), port.Get())
+	primary.setBroken(false)
+	require.Eventually(t, func() bool {
+		return port.Get() == 8080
+	}, time.Second, time.Millisecond)
+
+	// No more retries after Shutdown
+	mustShutdown(t, conf)
+	primary.setBroken(true)
+	conf.Refresh(ctx, "port")
+	assert.Equal(t, int64(8080), port.Get())
+}
@@ -0,0 +1,408 @@
+// Package vault allows distconf to read secrets out of HashiCorp Vault's KV version 2 secrets engine.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cep21/distconf"
+)
+
+// Secret is the location of a single value inside a KV version 2 secrets engine
+type Secret struct {
+	// Path of the secret relative to the mount.  For example "myapp/database"
+	Path string
+	// Field inside the secret's data to return as the value
+	Field string
+}
+
+// Reader maps distconf keys to secrets stored inside Vault.  Watched keys are detected by polling the
+// metadata endpoint of each secret and comparing its current version.  All public functions are thread safe.
+type Reader struct {
+	// Address of the vault server.  For example "https://vault.example.com:8200"
+	Address string
+	// Mount is where the KV version 2 engine is mounted.  Defaults to "secret"
+	Mount string
+	// Namespace is sent as X-Vault-Namespace if set
+	Namespace string
+	// Token is the vault token used for requests.  Ignored if TokenFile is set
+	Token string
+	// TokenFile is a file that contains the token, for example the sink of a vault agent.  It is re-read
+	// when vault rejects the current token and every time the token is renewed.
+	TokenFile string
+	// RenewToken, if true, periodically renews the token with auth/token/renew-self at half its lease duration
+	RenewToken bool
+	// Keys maps distconf keys to vault secrets.  Keys not inside this map are not in this reader.
+	Keys map[string]Secret
+	// Client is used for all HTTP requests.  Defaults to http.DefaultClient
+	Client *http.Client
+	// PollInterval is how often watched secrets have their metadata checked.  Defaults to 30 seconds
+	PollInterval time.Duration
+	// Hooks report errors that happen in the background
+	Hooks distconf.Hooks
+
+	startOnce sync.Once
+	onClose   chan struct{}
+	wg        sync.WaitGroup
+
+	mu       sync.Mutex
+	watches  map[string]func()
+	versions map[string]int64
+	token    string
+}
+
+var _ distconf.Reader = &Reader{}
+var _ distconf.Watcher = &Reader{}
+var _ distconf.Shutdownable = &Reader{}
+
+// errPermissionDenied is returned when vault rejects our token
+var errPermissionDenied = errors.New("vault permission denied")
+
+// unknownVersion is stored for watched paths whose version could not be fetched.  The next successful poll
+// will trigger their callbacks.
+const unknownVersion = -1
+
+func (r *Reader) onError(msg string, key string, err error) {
+	if r.Hooks.OnError != nil {
+		r.Hooks.OnError(msg, key, err)
+	}
+}
+
+func (r *Reader) client() *http.Client {
+	if r.Client == nil {
+		return http.DefaultClient
+	}
+	return r.Client
+}
+
+func (r *Reader) mount() string {
+	if r.Mount == "" {
+		return "secret"
+	}
+	return strings.Trim(r.Mount, "/")
+}
+
+func (r *Reader) pollInterval() time.Duration {
+	if r.PollInterval == 0 {
+		return time.Second * 30
+	}
+	return r.PollInterval
+}
+
+func (r *Reader) start() {
+	r.startOnce.Do(func() {
+		r.onClose = make(chan struct{})
+		r.wg.Add(1)
+		go r.pollLoop()
+		if r.RenewToken {
+			r.wg.Add(1)
+			go r.renewLoop()
+		}
+	})
+}
+
+// Read returns the field of the secret that key maps to.  Strings are returned as is.  Other JSON values are
+// returned as their JSON encoding.
+func (r *Reader) Read(ctx context.Context, key string) ([]byte, error) {
+	r.start()
+	secret, exists := r.Keys[key]
+	if !exists {
+		return nil, nil
+	}
+	var resp struct {
+		Data *struct {
+			Data map[string]json.RawMessage `json:"data"`
+		} `json:"data"`
+	}
+	found, err := r.do(ctx, http.MethodGet, "/v1/"+r.mount()+"/data/"+escapePath(secret.Path), &resp)
+	if err != nil {
+		return nil, err
+	}
+	if !found || resp.Data == nil {
+		return nil, nil
+	}
+	field, exists := resp.Data.Data[secret.Field]
+	if !exists {
+		return nil, nil
+	}
+	return fieldValue(field)
+}
+
+// fieldValue turns a JSON value inside a secret into the bytes distconf should parse
+func fieldValue(field json.RawMessage) ([]byte, error) {
+	trimmed := bytes.TrimSpace(field)
+	if bytes.Equal(trimmed, []byte("null")) {
+		return nil, nil
+	}
+	if len(trimmed) > 0 && trimmed[0] == '"' {
+		var s string
+		if err := json.Unmarshal(trimmed, &s); err != nil {
+			return nil, err
+		}
+		return []byte(s), nil
+	}
+	return trimmed, nil
+}
+
+// Watch registers callback to execute when the version of the secret key maps to changes.  A nil callback
+// removes the watch.
+func (r *Reader) Watch(ctx context.Context, key string, callback func()) error {
+	r.start()
+	secret, exists := r.Keys[key]
+	r.mu.Lock()
+	if callback == nil {
+		delete(r.watches, key)
+		r.mu.Unlock()
+		return nil
+	}
+	if r.watches == nil {
+		r.watches = make(map[string]func())
+	}
+	r.watches[key] = callback
+	_, hasVersion := r.versions[secret.Path]
+	r.mu.Unlock()
+	if !exists || hasVersion {
+		return nil
+	}
+	version, err := r.currentVersion(ctx, secret.Path)
+	if err != nil {
+		version = unknownVersion
+	}
+	r.mu.Lock()
+	if r.versions == nil {
+		r.versions = make(map[string]int64)
+	}
+	if _, hasVersion := r.versions[secret.Path]; !hasVersion {
+		r.versions[secret.Path] = version
+	}
+	r.mu.Unlock()
+	return err
+}
+
+// Shutdown stops all background polling and token renewal
+func (r *Reader) Shutdown(ctx context.Context) error {
+	r.start()
+	r.mu.Lock()
+	select {
+	case <-r.onClose:
+	default:
+		close(r.onClose)
+	}
+	r.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Reader) currentVersion(ctx context.Context, path string) (int64, error) {
+	var resp struct {
+		Data struct {
+			CurrentVersion int64 `json:"current_version"`
+		} `json:"data"`
+	}
+	found, err := r.do(ctx, http.MethodGet, "/v1/"+r.mount()+"/metadata/"+escapePath(path), &resp)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, nil
+	}
+	return resp.Data.CurrentVersion, nil
+}
+
+func (r *Reader) pollLoop() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.pollInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.onClose:
+			return
+		case <-ticker.C:
+			r.poll()
+		}
+	}
+}
+
+// poll checks the version of every watched secret and triggers callbacks for the ones that changed
+func (r *Reader) poll() {
+	paths := make(map[string]struct{})
+	r.mu.Lock()
+	for key := range r.watches {
+		if secret, exists := r.Keys[key]; exists {
+			paths[secret.Path] = struct{}{}
+		}
+	}
+	r.mu.Unlock()
+	for path := range paths {
+		ctx, cancel := context.WithTimeout(context.Background(), r.pollInterval())
+		version, err := r.currentVersion(ctx, path)
+		cancel()
+		if err != nil {
+			r.onError("unable to fetch secret metadata", path, err)
+			continue
+		}
+		var toCall []func()
+		r.mu.Lock()
+		// Watch may not have stored a version yet
+		if r.versions == nil {
+			r.versions = make(map[string]int64)
+		}
+		if r.versions[path] != version {
+			r.versions[path] = version
+			for key, callback := range r.watches {
+				if r.Keys[key].Path == path {
+					toCall = append(toCall, callback)
+				}
+			}
+		}
+		r.mu.Unlock()
+		for _, callback := range toCall {
+			callback()
+		}
+	}
+}
+
+func (r *Reader) renewLoop() {
+	defer r.wg.Done()
+	for {
+		wait := r.pollInterval()
+		ctx, cancel := context.WithTimeout(context.Background(), r.pollInterval())
+		leaseDuration, err := r.renew(ctx)
+		cancel()
+		if err != nil {
+			r.onError("unable to renew vault token", "", err)
+		} else if leaseDuration > 0 {
+			wait = leaseDuration / 2
+		}
+		select {
+		case <-r.onClose:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// renew the current token, returning its new lease duration
+func (r *Reader) renew(ctx context.Context) (time.Duration, error) {
+	r.reloadTokenFile()
+	var resp struct {
+		Auth *struct {
+			LeaseDuration int64 `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	if _, err := r.do(ctx, http.MethodPost, "/v1/auth/token/renew-self", &resp); err != nil {
+		return 0, err
+	}
+	if resp.Auth == nil {
+		return 0, nil
+	}
+	return time.Duration(resp.Auth.LeaseDuration) * time.Second, nil
+}
+
+func (r *Reader) currentToken() string {
+	if r.TokenFile == "" {
+		return r.Token
+	}
+	r.mu.Lock()
+	token := r.token
+	r.mu.Unlock()
+	if token == "" {
+		return r.reloadTokenFile()
+	}
+	return token
+}
+
+// reloadTokenFile re-reads TokenFile, if set, and returns the token inside it
+func (r *Reader) reloadTokenFile() string {
+	if r.TokenFile == "" {
+		return r.Token
+	}
+	b, err := ioutil.ReadFile(r.TokenFile)
+	if err != nil {
+		r.onError("unable to read vault token file", "", err)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.token
+	}
+	token := strings.TrimSpace(string(b))
+	r.mu.Lock()
+	r.token = token
+	r.mu.Unlock()
+	return token
+}
+
+// do executes a vault request, decoding the JSON body into into.  A 404 returns false without an error.  If vault
+// rejects the token, the token file is re-read and the request tried once more.
+func (r *Reader) do(ctx context.Context, method string, path string, into interface{}) (bool, error) {
+	found, err := r.doOnce(ctx, method, path, r.currentToken(), into)
+	if err == errPermissionDenied && r.TokenFile != "" {
+		return r.doOnce(ctx, method, path, r.reloadTokenFile(), into)
+	}
+	return found, err
+}
+
+func (r *Reader) doOnce(ctx context.Context, method string, path string, token string, into interface{}) (bool, error) {
+	req, err := http.NewRequest(method, strings.TrimRight(r.Address, "/")+path, nil)
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("X-Vault-Token", token)
+	if r.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", r.Namespace)
+	}
+	resp, err := r.client().Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			r.onError("unable to close response body", path, err)
+		}
+	}()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	case resp.StatusCode == http.StatusForbidden:
+		return false, errPermissionDenied
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return false, fmt.Errorf("unexpected vault status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	case len(body) == 0 || resp.StatusCode == http.StatusNoContent:
+		return true, nil
+	}
+	if err := json.Unmarshal(body, into); err != nil {
+		return false, fmt.Errorf("unable to decode vault response: %v", err)
+	}
+	return true, nil
+}
+
+// escapePath escapes each element of a secret path, keeping the / separators
+func escapePath(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := range parts {
+		parts[i] = url.PathEscape(parts[i])
+	}
+	return strings.Join(parts, "/")
+}
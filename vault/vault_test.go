@@ -0,0 +1,228 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cep21/distconf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeVault emulates the parts of the vault HTTP API that Reader uses
+type fakeVault struct {
+	mu       sync.Mutex
+	token    string
+	secrets  map[string]map[string]interface{}
+	versions map[string]int64
+	renews   int64
+}
+
+func (f *fakeVault) write(path string, data map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.secrets == nil {
+		f.secrets = make(map[string]map[string]interface{})
+		f.versions = make(map[string]int64)
+	}
+	f.secrets[path] = data
+	f.versions[path]++
+}
+
+func (f *fakeVault) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if req.Header.Get("X-Vault-Token") != f.token {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+	var resp interface{}
+	switch {
+	case req.URL.Path == "/v1/auth/token/renew-self" && req.Method == http.MethodPost:
+		atomic.AddInt64(&f.renews, 1)
+		resp = map[string]interface{}{"auth": map[string]interface{}{"lease_duration": 3600}}
+	case strings.HasPrefix(req.URL.Path, "/v1/secret/data/"):
+		path := strings.TrimPrefix(req.URL.Path, "/v1/secret/data/")
+		data, exists := f.secrets[path]
+		if !exists {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		resp = map[string]interface{}{"data": map[string]interface{}{
+			"data":     data,
+			"metadata": map[string]interface{}{"version": f.versions[path]},
+		}}
+	case strings.HasPrefix(req.URL.Path, "/v1/secret/metadata/"):
+		path := strings.TrimPrefix(req.URL.Path, "/v1/secret/metadata/")
+		if _, exists := f.secrets[path]; !exists {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		resp = map[string]interface{}{"data": map[string]interface{}{"current_version": f.versions[path]}}
+	default:
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err := json.NewEncoder(rw).Encode(resp); err != nil {
+		panic(err)
+	}
+}
+
+func mustShutdown(t *testing.T, s distconf.Shutdownable) {
+	require.NoError(t, s.Shutdown(context.Background()))
+}
+
+func TestReader_Read(t *testing.T) {
+	ctx := context.Background()
+	f := &fakeVault{token: "root"}
+	f.write("app/db", map[string]interface{}{"password": "hunter2", "port": 5432, "enabled": true})
+	s := httptest.NewServer(f)
+	defer s.Close()
+	r := &Reader{
+		Address: s.URL,
+		Token:   "root",
+		Keys: map[string]Secret{
+			"db.password": {Path: "app/db", Field: "password"},
+			"db.port":     {Path: "app/db", Field: "port"},
+			"db.enabled":  {Path: "app/db", Field: "enabled"},
+			"db.missing":  {Path: "app/db", Field: "missing"},
+			"other":       {Path: "app/other", Field: "x"},
+		},
+	}
+	defer mustShutdown(t, r)
+
+	b, err := r.Read(ctx, "db.password")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", string(b))
+
+	b, err = r.Read(ctx, "db.port")
+	require.NoError(t, err)
+	assert.Equal(t, "5432", string(b))
+
+	b, err = r.Read(ctx, "db.enabled")
+	require.NoError(t, err)
+	assert.Equal(t, "true", string(b))
+
+	for _, key := range []string{"db.missing", "other", "not_mapped"} {
+		b, err = r.Read(ctx, key)
+		require.NoError(t, err)
+		assert.Nil(t, b, key)
+	}
+
+	r.Token = "wrong"
+	_, err = r.Read(ctx, "db.password")
+	assert.Equal(t, errPermissionDenied, err)
+}
+
+func TestReader_Watch(t *testing.T) {
+	ctx := context.Background()
+	f := &fakeVault{token: "root"}
+	f.write("app/db", map[string]interface{}{"password": "hunter2"})
+	s := httptest.NewServer(f)
+	defer s.Close()
+	r := &Reader{
+		Address:      s.URL,
+		Token:        "root",
+		PollInterval: time.Millisecond,
+		Keys: map[string]Secret{
+			"db.password": {Path: "app/db", Field: "password"},
+		},
+	}
+	d := &distconf.Distconf{
+		Readers: []distconf.Reader{r},
+	}
+	defer mustShutdown(t, r)
+	defer mustShutdown(t, d)
+
+	pass := d.Str(ctx, "db.password", "")
+	assert.Equal(t, "hunter2", pass.Get())
+
+	f.write("app/db", map[string]interface{}{"password": "rotated"})
+	require.Eventually(t, func() bool {
+		return pass.Get() == "rotated"
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, r.Watch(ctx, "db.password", nil))
+	f.write("app/db", map[string]interface{}{"password": "again"})
+	time.Sleep(time.Millisecond * 20)
+	assert.Equal(t, "rotated", pass.Get())
+}
+
+func TestReader_TokenFile(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "TestReader_TokenFile")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("first\n"), 0600))
+
+	f := &fakeVault{token: "first"}
+	f.write("app/db", map[string]interface{}{"password": "hunter2"})
+	s := httptest.NewServer(f)
+	defer s.Close()
+	r := &Reader{
+		Address:    s.URL,
+		TokenFile:  tokenFile,
+		RenewToken: true,
+		Keys: map[string]Secret{
+			"db.password": {Path: "app/db", Field: "password"},
+		},
+	}
+	defer mustShutdown(t, r)
+
+	b, err := r.Read(ctx, "db.password")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", string(b))
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt64(&f.renews) > 0
+	}, time.Second, time.Millisecond)
+
+	// The token rotates: the reader should notice the rejected token and read the new one from disk
+	f.mu.Lock()
+	f.token = "second"
+	f.mu.Unlock()
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("second"), 0600))
+	b, err = r.Read(ctx, "db.password")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", string(b))
+}
+
+func TestReader_errors(t *testing.T) {
+	ctx := context.Background()
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer s.Close()
+	var errCount int64
+	r := &Reader{
+		Address:      s.URL,
+		PollInterval: time.Millisecond,
+		Keys: map[string]Secret{
+			"db.password": {Path: "app/db", Field: "password"},
+		},
+		Hooks: distconf.Hooks{
+			OnError: func(msg string, distconfKey string, err error) {
+				atomic.AddInt64(&errCount, 1)
+			},
+		},
+	}
+	defer mustShutdown(t, r)
+	_, err := r.Read(ctx, "db.password")
+	assert.Error(t, err)
+	assert.Error(t, r.Watch(ctx, "db.password", func() {}))
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt64(&errCount) > 0
+	}, time.Second, time.Millisecond)
+}
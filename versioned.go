@@ -0,0 +1,76 @@
+package distconf
+
+import (
+	"context"
+	"sync"
+)
+
+// versionState is the version of the value currently applied to a variable
+type versionState struct {
+	// applyMu is held while a value is checked and applied, so values are applied in the order they are checked
+	applyMu sync.Mutex
+	// mu protects the fields below.  It is never held while watches run, so watches can call Info.
+	mu sync.Mutex
+	// reader the applied value came from.  nil if no Reader had the key
+	reader Reader
+	// key the applied value was read from, which is an alias if an alias supplied it
+	key string
+	// version of the applied value.  0 if unknown
+	version int64
+}
+
+func (s *versionState) get() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.version
+}
+
+// source returns the Reader of the applied value
+func (s *versionState) source() Reader {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reader
+}
+
+// isVersioned returns true if r is a VersionedReader that is not just a wrapper of a Reader without versions
+func isVersioned(r Reader) bool {
+	for {
+		w, ok := r.(wrapper)
+		if !ok {
+			_, ok = r.(VersionedReader)
+			return ok
+		}
+		r = w.wrapped()
+	}
+}
+
+// readVersioned reads key from r, with ReadVersioned if it is a VersionedReader.  version is 0 if it is not.
+func readVersioned(ctx context.Context, r Reader, key string) ([]byte, int64, error) {
+	if versioned, ok := r.(VersionedReader); ok {
+		return versioned.ReadVersioned(ctx, key)
+	}
+	value, err := r.Read(ctx, key)
+	return value, 0, err
+}
+
+// update applies value to rv, unless it was read from the same Reader and key as the applied value with a version
+// that is not newer.  This stops out of order refreshes from overwriting a newer value with an older one.  Versions
+// of different Readers or keys are not comparable, so a value from another Reader or alias is always applied.
+func (c *Distconf) update(rv *registeredVariableTracker, reader Reader, key string, value []byte, version int64) error {
+	if err := rv.options.validate(value); err != nil {
+		return err
+	}
+	state := &rv.version
+	state.applyMu.Lock()
+	defer state.applyMu.Unlock()
+	state.mu.Lock()
+	if version != 0 && state.version != 0 && sameInstance(state.reader, reader) && state.key == key && version <= state.version {
+		state.mu.Unlock()
+		return nil
+	}
+	state.reader = reader
+	state.key = key
+	state.version = version
+	state.mu.Unlock()
+	return rv.distvar.Update(value)
+}
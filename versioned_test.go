@@ -0,0 +1,102 @@
+package distconf
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// versionedBacking returns whatever value and version were last set, even if the version went backwards
+type versionedBacking struct {
+	mu      sync.Mutex
+	value   []byte
+	version int64
+}
+
+func (v *versionedBacking) set(value string, version int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.value = nil
+	if value != "" {
+		v.value = []byte(value)
+	}
+	v.version = version
+}
+
+func (v *versionedBacking) Read(ctx context.Context, key string) ([]byte, error) {
+	b, _, err := v.ReadVersioned(ctx, key)
+	return b, err
+}
+
+func (v *versionedBacking) ReadVersioned(_ context.Context, key string) ([]byte, int64, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.value, v.version, nil
+}
+
+func TestDistconf_VersionedReader(t *testing.T) {
+	ctx := context.Background()
+	primary := &versionedBacking{}
+	fallback := &Mem{}
+	require.NoError(t, fallback.Write(ctx, "host", []byte("fallback.com")))
+	conf := &Distconf{Readers: []Reader{primary, fallback}}
+	defer mustShutdown(t, conf)
+	primary.set("b.com", 2)
+	host := conf.Str(ctx, "host", "")
+	assert.Equal(t, "b.com", host.Get())
+
+	// An out of order read of an older version is ignored
+	primary.set("a.com", 1)
+	conf.Refresh(ctx, "host")
+	assert.Equal(t, "b.com", host.Get())
+	primary.set("c.com", 3)
+	conf.Refresh(ctx, "host")
+	assert.Equal(t, "c.com", host.Get())
+
+	var info map[string]distInfo
+	require.NoError(t, json.Unmarshal([]byte(conf.Info().String()), &info))
+	assert.Equal(t, int64(3), info["host"].Version)
+
+	// Versions restart when the value comes from another Reader
+	primary.set("", 0)
+	conf.Refresh(ctx, "host")
+	assert.Equal(t, "fallback.com", host.Get())
+	primary.set("a.com", 1)
+	conf.Refresh(ctx, "host")
+	assert.Equal(t, "a.com", host.Get())
+}
+
+func TestDistconf_InfoInsideWatch(t *testing.T) {
+	ctx := context.Background()
+	backing := &versionedBacking{}
+	conf := &Distconf{Readers: []Reader{backing}}
+	defer mustShutdown(t, conf)
+	port := conf.Int(ctx, "port", 0)
+	var info map[string]distInfo
+	var schema []byte
+	port.Watch(func(*Int, int64) {
+		// Watches run while a value is applied, so reading the applied version here must not deadlock
+		require.NoError(t, json.Unmarshal([]byte(conf.Info().String()), &info))
+		var err error
+		schema, err = conf.ExportSchema()
+		require.NoError(t, err)
+	})
+	backing.set("8080", 4)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conf.Refresh(ctx, "port")
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("Info inside a watch deadlocked")
+	}
+	assert.Equal(t, int64(4), info["port"].Version)
+	assert.NotEmpty(t, schema)
+}